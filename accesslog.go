@@ -0,0 +1,297 @@
+package rapidroot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// AccessLogFormat is the format of access log lines.
+type AccessLogFormat string
+
+// Formats of the access log.
+const (
+	// AccessLogCommon is the Apache Common Log Format.
+	AccessLogCommon AccessLogFormat = "common"
+	// AccessLogCombined is the Apache Combined Log Format, the common format
+	// with referer and user agent.
+	AccessLogCombined AccessLogFormat = "combined"
+	// AccessLogJSON writes a JSON object per line.
+	AccessLogJSON AccessLogFormat = "json"
+	// AccessLogLogfmt writes key=value pairs.
+	AccessLogLogfmt AccessLogFormat = "logfmt"
+)
+
+const commonLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogEntry is a single served request, it is passed to AccessLogConfig.Template
+// and AccessLogConfig.Skip.
+type AccessLogEntry struct {
+	Time      time.Time
+	Method    string
+	Path      string
+	Query     string
+	Proto     string
+	Status    int
+	Bytes     int64
+	Latency   time.Duration
+	ClientIP  string
+	UserAgent string
+	Referer   string
+	RequestID string
+	Handler   string
+}
+
+// AccessLogConfig configures the access log, see Router.SetAccessLog and AccessLog.
+type AccessLogConfig struct {
+	// Output of the log lines, defaults to os.Stdout.
+	Output io.Writer
+
+	// Format of the lines, defaults to AccessLogCombined.
+	Format AccessLogFormat
+
+	// Template is a text/template executed with AccessLogEntry, it replaces
+	// Format if it's set, e.g. "{{.Method}} {{.Path}} {{.Status}} {{.Latency}}".
+	Template string
+
+	// SkipPaths are the paths that aren't logged, e.g. "/healthz".
+	SkipPaths []string
+
+	// Skip reports whether the entry shouldn't be logged, e.g. to log only
+	// errors: func(e *rr.AccessLogEntry) bool { return e.Status < 400 }.
+	Skip func(entry *AccessLogEntry) bool
+}
+
+// accessLogger writes access log lines of AccessLogConfig.
+type accessLogger struct {
+	mu       sync.Mutex
+	config   AccessLogConfig
+	template *template.Template
+}
+
+func newAccessLogger(config AccessLogConfig) *accessLogger {
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+	if config.Format == "" {
+		config.Format = AccessLogCombined
+	}
+	logger := &accessLogger{config: config}
+	if config.Template != "" {
+		tmpl := config.Template
+		if !strings.HasSuffix(tmpl, "\n") {
+			tmpl += "\n"
+		}
+		logger.template = template.Must(template.New("access_log").Parse(tmpl))
+	}
+	return logger
+}
+
+// SetAccessLog replaces the request log of the router with the access log,
+// which covers all requests including not found ones and panics.
+// It panics if the config has an invalid template.
+//
+// Example:
+//
+//	router.SetAccessLog(rr.AccessLogConfig{
+//		Format:    rr.AccessLogJSON,
+//		SkipPaths: []string{"/healthz"},
+//	})
+func (r *Router) SetAccessLog(config AccessLogConfig) {
+	r.accessLog = newAccessLogger(config)
+}
+
+// AccessLog is a middleware that writes the access log of the routes it's
+// applied to. It panics if the config has an invalid template.
+//
+// Example:
+//
+//	router.GroupMiddleware(http.MethodGet, "/api", rr.AccessLog(rr.AccessLogConfig{
+//		Format: rr.AccessLogLogfmt,
+//		Skip:   func(e *rr.AccessLogEntry) bool { return e.Status < 400 },
+//	}))
+func AccessLog(config AccessLogConfig) Middleware {
+	logger := newAccessLogger(config)
+	return func(next HandlerFunc) HandlerFunc {
+		return func(req *Request) {
+			start := time.Now()
+			// deferred to log requests that panicked too
+			defer func() {
+				rec := recover()
+				logger.log(req.accessLogEntry(start, rec != nil))
+				if rec != nil {
+					panic(rec)
+				}
+			}()
+			next(req)
+		}
+	}
+}
+
+// accessLogEntry returns the entry of the request served since start, panicked
+// is set if the handler panicked.
+func (r *Request) accessLogEntry(start time.Time, panicked bool) *AccessLogEntry {
+	entry := &AccessLogEntry{
+		Time:      start,
+		Method:    r.Req.Method,
+		Path:      r.Req.URL.Path,
+		Query:     r.Req.URL.RawQuery,
+		Proto:     r.Req.Proto,
+		Status:    r.servedStatus(panicked),
+		Latency:   time.Since(start),
+		ClientIP:  r.ClientIP(),
+		UserAgent: r.Req.UserAgent(),
+		Referer:   r.Req.Referer(),
+		RequestID: r.Req.Header.Get(requestIDHeader),
+		Handler:   r.handlerName,
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = r.Writer.Header().Get(requestIDHeader)
+	}
+	if resp := unwrapCodeWrapper(r.Writer); resp != nil {
+		entry.Bytes = resp.bytesWritten
+	}
+	return entry
+}
+
+// servedStatus returns the status code sent to the client. Handlers that wrote
+// nothing respond with 200 unless they panicked, then the server drops the
+// connection, which is logged as 500.
+func (r *Request) servedStatus(panicked bool) int {
+	if status := r.GetStatus(); status != 0 {
+		return status
+	}
+	if panicked {
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+func (l *accessLogger) log(entry *AccessLogEntry) {
+	if contains(l.config.SkipPaths, entry.Path) || (l.config.Skip != nil && l.config.Skip(entry)) {
+		return
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if l.template != nil {
+		if err := l.template.Execute(buf, entry); err != nil {
+			buf.Reset()
+			fmt.Fprintf(buf, "access log template error: %v\n", err)
+		}
+	} else {
+		switch l.config.Format {
+		case AccessLogCommon:
+			writeCommonLog(buf, entry)
+			buf.WriteString("\n")
+		case AccessLogJSON:
+			writeJSONLog(buf, entry)
+		case AccessLogLogfmt:
+			writeLogfmtLog(buf, entry)
+		default:
+			writeCommonLog(buf, entry)
+			fmt.Fprintf(buf, " %s %s\n", quoteCommonLog(entry.Referer), quoteCommonLog(entry.UserAgent))
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	buf.WriteTo(l.config.Output)
+}
+
+// writeCommonLog writes the entry in the Common Log Format:
+// 127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326
+func writeCommonLog(w io.Writer, entry *AccessLogEntry) {
+	uri := entry.Path
+	if entry.Query != "" {
+		uri += "?" + entry.Query
+	}
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.FormatInt(entry.Bytes, 10)
+	}
+	fmt.Fprintf(w, "%s - - [%s] %s %d %s",
+		entry.ClientIP,
+		entry.Time.Format(commonLogTimeFormat),
+		quoteCommonLog(entry.Method+" "+uri+" "+entry.Proto),
+		entry.Status,
+		bytes,
+	)
+}
+
+func quoteCommonLog(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func writeJSONLog(w io.Writer, entry *AccessLogEntry) {
+	json.NewEncoder(w).Encode(struct {
+		Time      string  `json:"time"`
+		Method    string  `json:"method"`
+		Path      string  `json:"path"`
+		Query     string  `json:"query,omitempty"`
+		Proto     string  `json:"proto"`
+		Status    int     `json:"status"`
+		Bytes     int64   `json:"bytes"`
+		LatencyMS float64 `json:"latency_ms"`
+		ClientIP  string  `json:"client_ip"`
+		UserAgent string  `json:"user_agent,omitempty"`
+		Referer   string  `json:"referer,omitempty"`
+		RequestID string  `json:"request_id,omitempty"`
+		Handler   string  `json:"handler,omitempty"`
+	}{
+		Time:      entry.Time.Format(time.RFC3339Nano),
+		Method:    entry.Method,
+		Path:      entry.Path,
+		Query:     entry.Query,
+		Proto:     entry.Proto,
+		Status:    entry.Status,
+		Bytes:     entry.Bytes,
+		LatencyMS: float64(entry.Latency) / float64(time.Millisecond),
+		ClientIP:  entry.ClientIP,
+		UserAgent: entry.UserAgent,
+		Referer:   entry.Referer,
+		RequestID: entry.RequestID,
+		Handler:   entry.Handler,
+	})
+}
+
+func writeLogfmtLog(w io.Writer, entry *AccessLogEntry) {
+	pairs := []struct{ key, val string }{
+		{"time", entry.Time.Format(time.RFC3339)},
+		{"method", entry.Method},
+		{"path", entry.Path},
+		{"query", entry.Query},
+		{"status", strconv.Itoa(entry.Status)},
+		{"bytes", strconv.FormatInt(entry.Bytes, 10)},
+		{"latency", entry.Latency.String()},
+		{"client_ip", entry.ClientIP},
+		{"user_agent", entry.UserAgent},
+		{"referer", entry.Referer},
+		{"request_id", entry.RequestID},
+		{"handler", entry.Handler},
+	}
+	for i, pair := range pairs {
+		if i > 0 {
+			io.WriteString(w, " ")
+		}
+		io.WriteString(w, pair.key+"="+logfmtValue(pair.val))
+	}
+	io.WriteString(w, "\n")
+}
+
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\\\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
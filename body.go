@@ -0,0 +1,129 @@
+package rapidroot
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge is returned when the request body exceeds the body limit.
+var ErrBodyTooLarge = errors.New("rapidroot: request body is too large")
+
+// SetBodyLimit limits the size of request bodies of all routes to limit bytes,
+// zero disables the limit. The limit is applied when the body is read: bodies
+// with bigger Content-Length fail without being read, other bodies fail when
+// reading beyond the limit, and Request.Body responds with 413.
+// The BodyLimit middleware replaces the limit for a route.
+func (r *Router) SetBodyLimit(limit int64) {
+	r.bodyLimit = limit
+}
+
+// BodyLimit is a middleware that limits the size of request bodies of the route
+// to limit bytes, it replaces the limit of the router, even if it's bigger.
+// Requests with bigger Content-Length get 413 before the next handler is called.
+// Middlewares that read the body before it use the limit of the router.
+//
+// Example:
+//
+//	router.SetBodyLimit(1 << 20)
+//	router.Middleware(http.MethodPost, "/documents", rr.BodyLimit(1<<30))
+func BodyLimit(limit int64) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(req *Request) {
+			req.bodyLimit = limit
+			if limit > 0 && req.Req.ContentLength > limit {
+				req.bodyTooLarge()
+				return
+			}
+			next(req)
+		}
+	}
+}
+
+// limitBody sets the body limit of the request, it's applied when the body is
+// read for the first time, so the limit of the route replaces the router one.
+func (r *Request) limitBody(limit int64) {
+	r.bodyLimit = limit
+	if r.Req.Body == nil || r.Req.Body == http.NoBody {
+		return
+	}
+	r.rawBody = r.Req.Body
+	r.Req.Body = &limitedBody{req: r}
+}
+
+// bodyTooLarge responds with 413, the connection is closed after the response,
+// since the rest of the body isn't read.
+func (r *Request) bodyTooLarge() {
+	r.Writer.Header().Set("Connection", "close")
+	r.abortWithErr(http.StatusRequestEntityTooLarge, errors.New(http.StatusText(http.StatusRequestEntityTooLarge)))
+}
+
+// limitedBody reads the request body with the body limit in effect at the
+// first read.
+type limitedBody struct {
+	req    *Request
+	reader io.Reader
+	err    error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.reader, b.err = b.req.limitedReader()
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.reader.Read(p)
+}
+
+func (b *limitedBody) Close() error {
+	return b.req.rawBody.Close()
+}
+
+func (r *Request) limitedReader() (io.Reader, error) {
+	limit := r.bodyLimit
+	if limit <= 0 {
+		return r.rawBody, nil
+	}
+	if r.Req.ContentLength > limit {
+		if r.GetStatus() == 0 {
+			r.Writer.Header().Set("Connection", "close")
+		}
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	// the writer of the server closes the connection after the response if
+	// the limit is hit, the wrapper hides this from http.MaxBytesReader
+	w := r.Writer
+	if resp := unwrapCodeWrapper(w); resp != nil {
+		w = resp.ResponseWriter
+	}
+	return http.MaxBytesReader(w, r.rawBody, limit), nil
+}
+
+// Body returns the request body. The body is read once and cached, so it can
+// be read by several middlewares and the handler, also Req.Body is reset to
+// the start of the cached body on every call.
+// If the body exceeds the body limit, it responds with 413 and returns ErrBodyTooLarge.
+func (r *Request) Body() ([]byte, error) {
+	if r.bodyErr != nil {
+		return nil, r.bodyErr
+	}
+	if r.body == nil {
+		body, err := io.ReadAll(r.Req.Body)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				r.abortWithErr(http.StatusRequestEntityTooLarge, errors.New(http.StatusText(http.StatusRequestEntityTooLarge)))
+				err = ErrBodyTooLarge
+			}
+			r.bodyErr = err
+			return nil, err
+		}
+		r.Req.Body.Close()
+		r.body = body
+	}
+
+	r.Req.Body = io.NopCloser(bytes.NewReader(r.body))
+	return r.body, nil
+}
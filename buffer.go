@@ -0,0 +1,30 @@
+package rapidroot
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBufferSize limits the capacity of the buffers returned to the pool,
+// so a single big response doesn't keep its memory for the process lifetime.
+const maxPooledBufferSize = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer retrieves an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer resets the buffer and releases it back to the pool.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
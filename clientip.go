@@ -0,0 +1,77 @@
+package rapidroot
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// SetTrustedProxies sets the addresses of the proxies in front of the server,
+// as IPs or CIDR ranges. X-Forwarded-For and X-Real-IP headers are used by
+// Request.ClientIP only if the request comes from a trusted proxy.
+//
+// Example:
+//
+//	err := router.SetTrustedProxies("127.0.0.1", "10.0.0.0/8")
+func (r *Router) SetTrustedProxies(proxies ...string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	r.trustedProxies = prefixes
+	return nil
+}
+
+func (r *Router) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range r.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client. Forwarded headers are only
+// used for requests from the proxies set by Router.SetTrustedProxies, in that
+// case the closest address of X-Forwarded-For that isn't a trusted proxy is returned.
+func (r *Request) ClientIP() string {
+	remote, _, err := net.SplitHostPort(r.Req.RemoteAddr)
+	if err != nil {
+		remote = r.Req.RemoteAddr
+	}
+	if r.router == nil || !r.router.isTrustedProxy(remote) {
+		return remote
+	}
+
+	if forwarded := r.Req.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		addrs := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if i == 0 || !r.router.isTrustedProxy(addr) {
+				return addr
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Req.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return remote
+}
@@ -7,6 +7,20 @@ import (
 
 type cookies struct {
 	defaults *http.Cookie
+
+	// options holds the defaults, which are reused by pooled requests
+	options http.Cookie
+}
+
+// reset restores the default cookie options.
+func (c *cookies) reset() {
+	c.options = http.Cookie{
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/",
+	}
+	c.defaults = &c.options
 }
 
 // Cookie returns one value from cookies.
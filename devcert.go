@@ -0,0 +1,193 @@
+package rapidroot
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	devCAValidity   = 10 * 365 * 24 * time.Hour
+	devCertValidity = 365 * 24 * time.Hour
+	// the leaf certificate is regenerated when it expires sooner
+	devCertRenewBefore = 30 * 24 * time.Hour
+)
+
+// DevCertFiles are the files generated by GenerateDevCert.
+type DevCertFiles struct {
+	// CAFile is the certificate of the development CA, add it to the trust
+	// store of the system or the browser to trust the certificate.
+	CAFile string
+
+	CertFile string
+	KeyFile  string
+}
+
+// GenerateDevCert generates a self-signed CA and a certificate for local HTTPS,
+// which is valid for localhost, 127.0.0.1, ::1 and hosts. The files are cached
+// in dir, so the CA has to be trusted once, and the certificate is regenerated
+// when it expires or the hosts change. If dir is empty the user cache
+// directory is used. It must not be used in production.
+//
+// Example:
+//
+//	files, err := rr.GenerateDevCert("")
+//	// handle err
+//	log.Println("trust the CA:", files.CAFile)
+//	router.SetHTTPSConfig(rr.HTTPSConfig{Port: 8443})
+//	go router.RunRedirectToHTTPS(":8080")
+//	err = router.RunWithTLS(":8443", files.CertFile, files.KeyFile)
+func GenerateDevCert(dir string, hosts ...string) (DevCertFiles, error) {
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return DevCertFiles{}, err
+		}
+		dir = filepath.Join(cacheDir, "rapidroot", "devcert")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return DevCertFiles{}, err
+	}
+	files := DevCertFiles{
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	caKeyFile := filepath.Join(dir, "ca-key.pem")
+	hosts = append([]string{"localhost", "127.0.0.1", "::1"}, hosts...)
+
+	ca, caKey, err := loadDevCA(files.CAFile, caKeyFile)
+	if err != nil {
+		if ca, caKey, err = createDevCA(files.CAFile, caKeyFile); err != nil {
+			return DevCertFiles{}, fmt.Errorf("failed to create the development CA: %w", err)
+		}
+	}
+	if devCertValid(files.CertFile, files.KeyFile, ca, hosts) {
+		return files, nil
+	}
+	if err := createDevCert(files.CertFile, files.KeyFile, ca, caKey, hosts); err != nil {
+		return DevCertFiles{}, fmt.Errorf("failed to create the development certificate: %w", err)
+	}
+	return files, nil
+}
+
+func loadDevCA(certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok || !ca.IsCA || time.Now().After(ca.NotAfter) {
+		return nil, nil, errors.New("invalid development CA")
+	}
+	return ca, key, nil
+}
+
+func createDevCA(certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "RapidRoot Development CA", Organization: []string{"RapidRoot development"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(devCAValidity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, key, err := createCertificate(template, nil, nil, certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	return ca, key, err
+}
+
+func createDevCert(certFile, keyFile string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, hosts []string) error {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: hosts[0], Organization: []string{"RapidRoot development"}},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(devCertValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	_, _, err := createCertificate(template, ca, caKey, certFile, keyFile)
+	return err
+}
+
+// createCertificate signs the template with a new key by the parent, or by
+// itself if parent is nil, and writes the certificate and the key as PEM files.
+func createCertificate(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, certFile, keyFile string) ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return nil, nil, err
+	}
+	return der, key, nil
+}
+
+// devCertValid reports whether the cached certificate is signed by the CA,
+// isn't about to expire and is valid for all hosts.
+func devCertValid(certFile, keyFile string, ca *x509.Certificate, hosts []string) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil || cert.CheckSignatureFrom(ca) != nil || time.Now().Add(devCertRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+				return false
+			}
+		} else if !slices.Contains(cert.DNSNames, host) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package rapidroot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDevPollInterval = 500 * time.Millisecond
+	// number of source lines shown around the failing template line
+	devSourceContext = 5
+)
+
+// templateErrLocation matches the location in html/template errors,
+// e.g. "template: users/index.html:3:14: executing ...".
+var templateErrLocation = regexp.MustCompile(`template: ([^:\s]+):(\d+)`)
+
+// DevConfig configures the development mode, see Router.DevMode.
+type DevConfig struct {
+	// PollInterval is how often the templates directory is checked for changes.
+	// Defaults to 500ms.
+	PollInterval time.Duration
+}
+
+// DevMode enables the development mode for local iteration:
+//   - templates loaded by LoadTemplates are re-parsed when their files change,
+//     and the route table is printed after each reload;
+//   - render errors and panics respond with a detailed HTML page with the
+//     template source around the failing line and the stack trace, instead
+//     of the generic internal server error.
+//
+// It must not be enabled in production, since the error page exposes the source code.
+func (r *Router) DevMode(config DevConfig) {
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultDevPollInterval
+	}
+	r.devMode = true
+	r.devConfig = config
+	if r.templates.Load() != nil {
+		r.startTemplateWatcher()
+	}
+}
+
+// startTemplateWatcher polls the templates for changes and re-parses them.
+func (r *Router) startTemplateWatcher() {
+	r.watchTemplatesOnce.Do(func() {
+		go r.watchTemplates()
+	})
+}
+
+func (r *Router) watchTemplates() {
+	ticker := time.NewTicker(r.devConfig.PollInterval)
+	defer ticker.Stop()
+
+	fsys, _ := r.templateFiles()
+	snapshot := templatesSnapshot(fsys)
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		fsys, _ := r.templateFiles()
+		current := templatesSnapshot(fsys)
+		if current == snapshot {
+			continue
+		}
+		snapshot = current
+
+		if err := r.reloadTemplates(); err != nil {
+			r.templateErr.Store(&err)
+			r.log().Error("failed to reload templates", "error", err)
+			continue
+		}
+		r.templateErr.Store(nil)
+		r.log().Info("templates reloaded")
+		if routes := r.builtRoutes.Load(); routes != nil {
+			r.logRoutes(*routes)
+		}
+	}
+}
+
+// reloadTemplates re-parses the loaded templates, the lock is held until the
+// new set is stored, so templates loaded meanwhile aren't replaced by old ones.
+func (r *Router) reloadTemplates() error {
+	r.templateMu.Lock()
+	defer r.templateMu.Unlock()
+	set, err := parseTemplates(r.templateFS, r.templateConfig)
+	if err != nil {
+		return err
+	}
+	r.templates.Store(set)
+	return nil
+}
+
+// templatesSnapshot returns a string, which changes when any file of fsys is
+// added, removed or modified.
+func templatesSnapshot(fsys fs.FS) string {
+	var b strings.Builder
+	fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(&b, "%s|%d|%d\n", name, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return b.String()
+}
+
+// internalError aborts the request with 500. In the development mode the
+// response is a detailed error page, otherwise the generic error message.
+func (r *Request) internalError(err error) {
+	if r.router == nil || !r.router.devMode {
+		r.abortWithErr(http.StatusInternalServerError, errors.New(internalServerErr))
+		return
+	}
+	r.devErrorPage(err, debug.Stack())
+}
+
+// devErrorPage responds with the error, the template source around the
+// failing line, if the error comes from a template, and the stack trace.
+func (r *Request) devErrorPage(err error, stack []byte) {
+	r.isAborted = true
+
+	var b strings.Builder
+	b.WriteString("<!doctype html>\n<html><head><title>500 Internal Server Error</title>")
+	b.WriteString("<style>body{font-family:monospace;margin:2em}pre{background:#f4f4f4;padding:1em;overflow:auto}.line{background:#fdd}</style>")
+	b.WriteString("</head><body>\n<h1>500 Internal Server Error</h1>\n")
+	fmt.Fprintf(&b, "<p>%s %s | handler: %s</p>\n", html.EscapeString(r.Req.Method), html.EscapeString(r.Req.URL.Path), html.EscapeString(r.handlerName))
+	fmt.Fprintf(&b, "<h2>Error</h2>\n<pre>%s</pre>\n", html.EscapeString(err.Error()))
+	if source := r.router.templateSource(err); source != "" {
+		b.WriteString("<h2>Template</h2>\n" + source)
+	}
+	fmt.Fprintf(&b, "<h2>Stack trace</h2>\n<pre>%s</pre>\n</body></html>\n", html.EscapeString(string(stack)))
+
+	header := r.Writer.Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("X-Content-Type-Options", "nosniff")
+	r.Writer.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprint(r.Writer, b.String())
+}
+
+// templateSource returns the escaped template source around the line where
+// the template error occurred, or the empty string if err isn't a template error.
+func (r *Router) templateSource(err error) string {
+	fsys, _ := r.templateFiles()
+	match := templateErrLocation.FindStringSubmatch(err.Error())
+	if match == nil || fsys == nil {
+		return ""
+	}
+	name := match[1]
+	line, _ := strconv.Atoi(match[2])
+	content, readErr := fs.ReadFile(fsys, name)
+	if readErr != nil {
+		return ""
+	}
+
+	lines := strings.Split(string(content), "\n")
+	from, to := max(line-devSourceContext, 1), min(line+devSourceContext, len(lines))
+	var b strings.Builder
+	fmt.Fprintf(&b, "<p>%s:%d</p>\n<pre>", html.EscapeString(name), line)
+	for i := from; i <= to; i++ {
+		text := fmt.Sprintf("%4d | %s", i, html.EscapeString(lines[i-1]))
+		if i == line {
+			text = `<span class="line">` + text + "</span>"
+		}
+		b.WriteString(text + "\n")
+	}
+	b.WriteString("</pre>\n")
+	return b.String()
+}
+
+// recoverDevPanic responds with the detailed error page if the handler panics,
+// it must be deferred.
+func (r *Request) recoverDevPanic() {
+	if rec := recover(); rec != nil {
+		err := fmt.Errorf("panic: %v", rec)
+		r.logError("handler panicked", "error", err)
+		r.devErrorPage(err, debug.Stack())
+	}
+}
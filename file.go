@@ -0,0 +1,182 @@
+package rapidroot
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dispositionAttachment = "attachment"
+	dispositionInline     = "inline"
+
+	sniffLen = 512
+
+	// deadlineChunkSize is the size of the content written before the write
+	// deadline is extended again.
+	deadlineChunkSize = 1 << 20
+)
+
+// serveContent writes the content with http.ServeContent semantics: streaming,
+// Range, If-Range and conditional requests, and Content-Type detection by the
+// extension of the name or by sniffing. A strong ETag is derived from size and
+// modtime, unless the ETag header is already set, so If-Range and If-Match work.
+// Precompressed files have their own size and modtime, so each encoding gets
+// its own ETag.
+// If code is not 200, the whole content is sent with that code instead.
+// On the server of the router the write deadline is extended with every chunk
+// of the content, so big files aren't cut off by ServerConfig.WriteTimeout
+// while the client keeps reading.
+func (r *Request) serveContent(code int, name string, modtime time.Time, size int64, content io.ReadSeeker) {
+	w := r.Writer
+	if server := r.router.ownServer(r.Req); server != nil && server.WriteTimeout > 0 {
+		w = &deadlineWriter{ResponseWriter: r.Writer, rc: http.NewResponseController(r.Writer), timeout: server.WriteTimeout}
+	}
+	header := r.Writer.Header()
+	if header.Get("ETag") == "" && !modtime.IsZero() {
+		header.Set("ETag", fmt.Sprintf(`"%x-%x"`, size, modtime.UnixNano()))
+	}
+
+	if code == 0 || code == http.StatusOK {
+		http.ServeContent(w, r.Req, name, modtime, content)
+		return
+	}
+
+	if header.Get("Content-Type") == "" {
+		contentType, err := detectContentType(name, content)
+		if err != nil {
+			r.logError("failed to read file", "file", name, "error", err)
+			r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
+			return
+		}
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+	r.SetStatus(code)
+	if r.Req.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.CopyN(w, content, size); err != nil {
+		r.logError("failed to copy file", "file", name, "error", err)
+	}
+}
+
+// deadlineWriter extends the write deadline of the response before each write
+// of the content.
+type deadlineWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	d.rc.SetWriteDeadline(time.Now().Add(d.timeout))
+	return d.ResponseWriter.Write(p)
+}
+
+// ReadFrom copies src in chunks of deadlineChunkSize with the ReadFrom of the
+// response, so files are still sent with sendfile. Each chunk is a single
+// io.LimitedReader of the file, since sendfile doesn't unwrap nested ones.
+func (d *deadlineWriter) ReadFrom(src io.Reader) (int64, error) {
+	rf, ok := d.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		return io.Copy(writerOnly{d}, src)
+	}
+	remaining := int64(-1)
+	if limited, ok := src.(*io.LimitedReader); ok {
+		src, remaining = limited.R, limited.N
+	}
+
+	var written int64
+	for remaining != 0 {
+		chunk := int64(deadlineChunkSize)
+		if remaining > 0 && remaining < chunk {
+			chunk = remaining
+		}
+		d.rc.SetWriteDeadline(time.Now().Add(d.timeout))
+		n, err := rf.ReadFrom(&io.LimitedReader{R: src, N: chunk})
+		written += n
+		if remaining > 0 {
+			remaining -= n
+		}
+		if err != nil {
+			return written, err
+		}
+		if n < chunk {
+			// src is exhausted
+			break
+		}
+	}
+	return written, nil
+}
+
+// writerOnly hides the io.ReaderFrom of the writer from io.Copy.
+type writerOnly struct {
+	io.Writer
+}
+
+// detectContentType returns the media type by the extension of the name, or by
+// sniffing the first bytes of the content, which is then rewound.
+func detectContentType(name string, content io.ReadSeeker) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType, nil
+	}
+
+	var buf [sniffLen]byte
+	n, err := io.ReadFull(content, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// contentDisposition formats the Content-Disposition header as described in
+// RFC 6266, with an ASCII filename fallback and a UTF-8 encoded filename*
+// parameter for names that are not plain ASCII.
+func contentDisposition(dispositionType, filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	value := fmt.Sprintf(`%s; filename="%s"`, dispositionType, fallback)
+	if fallback != filename {
+		value += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return value
+}
+
+// encodeRFC5987 percent-encodes all bytes of s that are not attr-char.
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
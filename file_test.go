@@ -0,0 +1,61 @@
+package rapidroot
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readFromRecorder records the sources passed to ReadFrom.
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	sources []io.Reader
+}
+
+func (w *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	w.sources = append(w.sources, src)
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+// TestDeadlineWriterSendfile checks that the chunks of the content reach the
+// ReadFrom of the response as a single io.LimitedReader of the file, which
+// sendfile requires.
+func TestDeadlineWriterSendfile(t *testing.T) {
+	content := bytes.Repeat([]byte("rapidroot"), deadlineChunkSize/4)
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	rec := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w := &deadlineWriter{ResponseWriter: rec, rc: http.NewResponseController(rec), timeout: time.Minute}
+	n, err := io.CopyN(w, file, int64(len(content)))
+	if err != nil || n != int64(len(content)) {
+		t.Fatalf("CopyN = %d, %v", n, err)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), content) {
+		t.Fatal("content was changed")
+	}
+	if len(rec.sources) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(rec.sources))
+	}
+	for _, src := range rec.sources {
+		limited, ok := src.(*io.LimitedReader)
+		if !ok {
+			t.Fatalf("chunk is %T", src)
+		}
+		if _, ok := limited.R.(*os.File); !ok {
+			t.Fatalf("chunk reads from %T", limited.R)
+		}
+	}
+}
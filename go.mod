@@ -1,3 +1,3 @@
 module github.com/Folium1/RapidRoot
 
-go 1.21.5
+go 1.24.0
@@ -0,0 +1,318 @@
+package rapidroot
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// http2ClientPreface starts every HTTP/2 connection of a client.
+	http2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+	http2FrameHeaderLen    = 9
+	http2DefaultFrameSize  = 16384
+	http2FrameHeaders      = 0x1
+	http2FrameSettings     = 0x4
+	http2FrameContinuation = 0x9
+	http2FlagEndStream     = 0x1
+	http2FlagAck           = 0x1
+	http2FlagEndHeaders    = 0x4
+	http2SettingLen        = 6
+
+	// h2cPrefaceTimeout limits waiting for the client preface after the upgrade,
+	// if the server has no ReadHeaderTimeout.
+	h2cPrefaceTimeout = 10 * time.Second
+)
+
+// h2cHopHeaders are the connection-specific headers of the upgrade request,
+// which aren't allowed in HTTP/2.
+var h2cHopHeaders = []string{
+	"Connection", "Upgrade", "Http2-Settings", "Keep-Alive",
+	"Proxy-Connection", "Transfer-Encoding", "Te", "Host",
+}
+
+// h2cUpgradeHandler upgrades HTTP/1.1 requests with "Upgrade: h2c" to HTTP/2
+// as described in RFC 7540 section 3.2, other requests are passed to handler.
+// net/http only serves h2c with prior knowledge, so the upgraded connection
+// is passed to the server as a new connection, which starts with the client
+// preface. The request of the upgrade is replayed as stream 1 in front of the
+// frames of the client.
+type h2cUpgradeHandler struct {
+	handler  http.Handler
+	server   *http.Server
+	listener *connListener
+	serve    sync.Once
+}
+
+func newH2CUpgradeHandler(handler http.Handler, server *http.Server) *h2cUpgradeHandler {
+	return &h2cUpgradeHandler{
+		handler:  handler,
+		server:   server,
+		listener: newConnListener(),
+	}
+}
+
+func (h *h2cUpgradeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	settings, ok := h2cUpgradeSettings(req)
+	if !ok {
+		h.handler.ServeHTTP(w, req)
+		return
+	}
+	headers := h2cRequestHeaders(req)
+
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		// the request is served over HTTP/1.1, as if the upgrade wasn't requested
+		h.handler.ServeHTTP(w, req)
+		return
+	}
+	conn, err := h.upgrade(netConn, brw.Reader, settings, headers)
+	if err != nil {
+		netConn.Close()
+		h.server.ErrorLog.Printf("h2c upgrade from %s failed: %v", req.RemoteAddr, err)
+		return
+	}
+
+	h.serve.Do(func() {
+		go h.server.Serve(h.listener)
+	})
+	h.listener.push(conn)
+}
+
+// upgrade switches the connection to HTTP/2 and returns it with the client
+// preface, the client settings merged with settings and the request headers
+// as the first bytes to read.
+func (h *h2cUpgradeHandler) upgrade(conn net.Conn, br io.Reader, settings, headers []byte) (net.Conn, error) {
+	// the HTTP/2 server sets its own deadlines
+	conn.SetDeadline(time.Time{})
+	if _, err := io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n"); err != nil {
+		return nil, err
+	}
+
+	timeout := h.server.ReadHeaderTimeout
+	if timeout <= 0 {
+		timeout = h2cPrefaceTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	preface := make([]byte, len(http2ClientPreface)+http2FrameHeaderLen)
+	if _, err := io.ReadFull(br, preface); err != nil {
+		return nil, err
+	}
+	if string(preface[:len(http2ClientPreface)]) != http2ClientPreface {
+		return nil, errors.New("invalid client preface")
+	}
+	frameHeader := preface[len(http2ClientPreface):]
+	length := int(frameHeader[0])<<16 | int(frameHeader[1])<<8 | int(frameHeader[2])
+	if frameHeader[3] != http2FrameSettings || frameHeader[4]&http2FlagAck != 0 ||
+		binary.BigEndian.Uint32(frameHeader[5:]) != 0 || length%http2SettingLen != 0 || length > http2DefaultFrameSize {
+		return nil, errors.New("client preface isn't followed by settings")
+	}
+	clientSettings := make([]byte, length)
+	if _, err := io.ReadFull(br, clientSettings); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	// the settings of the upgrade request are merged into the first settings
+	// frame, so the client gets a single acknowledgement for both
+	var first bytes.Buffer
+	first.WriteString(http2ClientPreface)
+	writeHTTP2Frame(&first, http2FrameSettings, 0, 0, mergeHTTP2Settings(settings, clientSettings))
+	writeHTTP2Headers(&first, 1, headers)
+
+	return &h2cConn{Conn: conn, r: io.MultiReader(&first, br)}, nil
+}
+
+// mergeHTTP2Settings returns the settings payload with the values of override
+// replacing the values of base, each setting is sent once.
+func mergeHTTP2Settings(base, override []byte) []byte {
+	merged := make([]byte, 0, len(base)+len(override))
+	index := make(map[uint16]int)
+	for _, settings := range [][]byte{base, override} {
+		for i := 0; i+http2SettingLen <= len(settings); i += http2SettingLen {
+			setting := settings[i : i+http2SettingLen]
+			id := binary.BigEndian.Uint16(setting)
+			if at, ok := index[id]; ok {
+				copy(merged[at:], setting)
+				continue
+			}
+			index[id] = len(merged)
+			merged = append(merged, setting...)
+		}
+	}
+	return merged
+}
+
+// h2cUpgradeSettings returns the decoded HTTP2-Settings header of the request,
+// if it asks for the h2c upgrade. Requests with a body are served over
+// HTTP/1.1, since the body would have to be read before switching protocols.
+func h2cUpgradeSettings(req *http.Request) ([]byte, bool) {
+	if req.ProtoMajor != 1 || req.TLS != nil || req.Method == http.MethodConnect {
+		return nil, false
+	}
+	if !headerContainsToken(req.Header, "Upgrade", "h2c") || !headerContainsToken(req.Header, "Connection", "HTTP2-Settings") {
+		return nil, false
+	}
+	if req.ContentLength != 0 || len(req.TransferEncoding) > 0 {
+		return nil, false
+	}
+	values := req.Header.Values("HTTP2-Settings")
+	if len(values) != 1 {
+		return nil, false
+	}
+	settings, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(values[0], "="))
+	if err != nil || len(settings)%http2SettingLen != 0 || len(settings) > http2DefaultFrameSize {
+		return nil, false
+	}
+	return settings, true
+}
+
+// h2cRequestHeaders returns the HPACK encoded header block of the request,
+// with literals that aren't indexed, so the dynamic table isn't changed.
+func h2cRequestHeaders(req *http.Request) []byte {
+	var block []byte
+	block = appendHPACKLiteral(block, ":method", req.Method)
+	block = appendHPACKLiteral(block, ":scheme", "http")
+	block = appendHPACKLiteral(block, ":authority", req.Host)
+	block = appendHPACKLiteral(block, ":path", req.URL.RequestURI())
+
+	hop := make(map[string]bool, len(h2cHopHeaders))
+	for _, name := range h2cHopHeaders {
+		hop[name] = true
+	}
+	for _, value := range req.Header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			hop[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+	for name, values := range req.Header {
+		if hop[name] {
+			continue
+		}
+		for _, value := range values {
+			block = appendHPACKLiteral(block, strings.ToLower(name), value)
+		}
+	}
+	return block
+}
+
+// appendHPACKLiteral appends a literal header field without indexing and with
+// a new name, see RFC 7541 section 6.2.2.
+func appendHPACKLiteral(block []byte, name, value string) []byte {
+	block = append(block, 0)
+	block = appendHPACKString(block, name)
+	return appendHPACKString(block, value)
+}
+
+// appendHPACKString appends a string literal without Huffman encoding.
+func appendHPACKString(block []byte, s string) []byte {
+	const prefix = 1<<7 - 1
+	length := uint64(len(s))
+	if length < prefix {
+		block = append(block, byte(length))
+	} else {
+		block = append(block, prefix)
+		length -= prefix
+		for length >= 128 {
+			block = append(block, byte(length%128+128))
+			length /= 128
+		}
+		block = append(block, byte(length))
+	}
+	return append(block, s...)
+}
+
+// writeHTTP2Headers writes the header block of a request without body, split
+// into a HEADERS frame and CONTINUATION frames of the default frame size.
+func writeHTTP2Headers(w *bytes.Buffer, streamID uint32, block []byte) {
+	frameType, flags := byte(http2FrameHeaders), byte(http2FlagEndStream)
+	for {
+		chunk := block
+		if len(chunk) > http2DefaultFrameSize {
+			chunk = chunk[:http2DefaultFrameSize]
+		}
+		block = block[len(chunk):]
+		if len(block) == 0 {
+			flags |= http2FlagEndHeaders
+		}
+		writeHTTP2Frame(w, frameType, flags, streamID, chunk)
+		if len(block) == 0 {
+			return
+		}
+		frameType, flags = http2FrameContinuation, 0
+	}
+}
+
+func writeHTTP2Frame(w *bytes.Buffer, frameType, flags byte, streamID uint32, payload []byte) {
+	length := len(payload)
+	w.Write([]byte{byte(length >> 16), byte(length >> 8), byte(length), frameType, flags})
+	binary.Write(w, binary.BigEndian, streamID&(1<<31-1))
+	w.Write(payload)
+}
+
+// h2cConn is an upgraded connection, reads start with the replayed frames.
+type h2cConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *h2cConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// connListener is a net.Listener of connections passed by push, it lets the
+// server track connections that were accepted by another listener.
+type connListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newConnListener() *connListener {
+	return &connListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// push passes the connection to Accept, or closes it if the listener is closed.
+func (l *connListener) push(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, fmt.Errorf("accept h2c upgrade: %w", net.ErrClosed)
+	}
+}
+
+func (l *connListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return h2cAddr{}
+}
+
+// h2cAddr is the address of connListener, the connections keep their own addresses.
+type h2cAddr struct{}
+
+func (h2cAddr) Network() string { return "h2c" }
+func (h2cAddr) String() string  { return "h2c upgrade" }
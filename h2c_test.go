@@ -0,0 +1,191 @@
+package rapidroot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upgradeSettings is the HTTP2-Settings header of curl: MAX_CONCURRENT_STREAMS,
+// INITIAL_WINDOW_SIZE and ENABLE_PUSH.
+const upgradeSettings = "AAMAAABkAAQCAAAAAAIAAAAA"
+
+func newH2CServer(t *testing.T, h2c bool) *httptest.Server {
+	t.Helper()
+	router := NewRouter()
+	protoHandler := func(req *Request) {
+		req.BINARY(http.StatusOK, []byte(req.Req.Proto+" "+req.Req.Method+" "+req.Req.URL.RequestURI()+" "+req.Req.Header.Get("X-Test")))
+	}
+	router.GET("/proto", protoHandler)
+	router.POST("/proto", protoHandler)
+	if err := router.Build(); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultServerConfig()
+	config.H2C = h2c
+	router.SetServerConfig(config)
+
+	server := httptest.NewUnstartedServer(nil)
+	server.Config = router.newServer("")
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	server := newH2CServer(t, true)
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	resp, err := client.Get(server.URL + "/proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.ProtoMajor != 2 || string(body) != "HTTP/2.0 GET /proto " {
+		t.Fatalf("got %s %q", resp.Proto, body)
+	}
+}
+
+// h2cClient is a minimal HTTP/2 client, which upgrades an HTTP/1.1 connection.
+type h2cClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialH2C(t *testing.T, server *httptest.Server, request string) (*h2cClient, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &h2cClient{t: t, conn: conn, br: br}, resp
+}
+
+func (c *h2cClient) writeFrame(frameType, flags byte, streamID uint32, payload []byte) {
+	c.t.Helper()
+	frame := []byte{byte(len(payload) >> 16), byte(len(payload) >> 8), byte(len(payload)), frameType, flags}
+	frame = binary.BigEndian.AppendUint32(frame, streamID)
+	if _, err := c.conn.Write(append(frame, payload...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *h2cClient) readFrame() (frameType, flags byte, streamID uint32, payload []byte) {
+	c.t.Helper()
+	var header [http2FrameHeaderLen]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[3], header[4], binary.BigEndian.Uint32(header[5:]) & (1<<31 - 1), payload
+}
+
+// readResponse returns the header block and the body of the response on the stream.
+func (c *h2cClient) readResponse(streamID uint32) (headers, body []byte) {
+	c.t.Helper()
+	const frameData, frameGoAway = 0x0, 0x7
+	for {
+		frameType, flags, id, payload := c.readFrame()
+		switch {
+		case frameType == frameGoAway:
+			c.t.Fatalf("server sent GOAWAY with code %d", binary.BigEndian.Uint32(payload[4:]))
+		case id != streamID:
+			continue
+		case frameType == http2FrameHeaders:
+			headers = append(headers, payload...)
+		case frameType == frameData:
+			body = append(body, payload...)
+		}
+		if flags&http2FlagEndStream != 0 {
+			return headers, body
+		}
+	}
+}
+
+func TestH2CUpgrade(t *testing.T) {
+	server := newH2CServer(t, true)
+	client, resp := dialH2C(t, server, "GET /proto?q=1 HTTP/1.1\r\nHost: example.com\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: "+upgradeSettings+"\r\n"+
+		"X-Test: upgraded\r\n\r\n")
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Upgrade") != "h2c" {
+		t.Fatalf("status = %d, upgrade = %q", resp.StatusCode, resp.Header.Get("Upgrade"))
+	}
+
+	// the client preface, its settings repeat a setting of the upgrade request
+	io.WriteString(client.conn, http2ClientPreface)
+	client.writeFrame(http2FrameSettings, 0, 0, []byte{0, 3, 0, 0, 0, 100})
+
+	headers, body := client.readResponse(1)
+	// the indexed field ":status: 200" of the static table
+	if len(headers) == 0 || headers[0] != 0x88 {
+		t.Fatalf("response headers = %x, want status 200", headers)
+	}
+	if string(body) != "HTTP/2.0 GET /proto?q=1 upgraded" {
+		t.Fatalf("body = %q", body)
+	}
+
+	// the connection serves further streams
+	block := appendHPACKLiteral(nil, ":method", "GET")
+	block = appendHPACKLiteral(block, ":scheme", "http")
+	block = appendHPACKLiteral(block, ":authority", "example.com")
+	block = appendHPACKLiteral(block, ":path", "/proto")
+	client.writeFrame(http2FrameHeaders, http2FlagEndStream|http2FlagEndHeaders, 3, block)
+	if _, body := client.readResponse(3); string(body) != "HTTP/2.0 GET /proto " {
+		t.Fatalf("body of stream 3 = %q", body)
+	}
+}
+
+func TestH2CUpgradeWithBody(t *testing.T) {
+	server := newH2CServer(t, true)
+	_, resp := dialH2C(t, server, "POST /proto HTTP/1.1\r\nHost: example.com\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: "+upgradeSettings+"\r\n"+
+		"Content-Length: 4\r\n\r\nbody")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(string(body), "HTTP/1.1 POST") {
+		t.Fatalf("got %d %q, want the request served over HTTP/1.1", resp.StatusCode, body)
+	}
+}
+
+func TestH2CDisabled(t *testing.T) {
+	server := newH2CServer(t, false)
+	_, resp := dialH2C(t, server, "GET /proto HTTP/1.1\r\nHost: example.com\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: "+upgradeSettings+"\r\n\r\n")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(string(body), "HTTP/1.1 GET") {
+		t.Fatalf("got %d %q, want the request served over HTTP/1.1", resp.StatusCode, body)
+	}
+}
+
+func TestMergeHTTP2Settings(t *testing.T) {
+	base := []byte{0, 3, 0, 0, 0, 100, 0, 4, 0, 0, 0xff, 0xff}
+	override := []byte{0, 4, 0, 0, 0, 1, 0, 2, 0, 0, 0, 0}
+	want := []byte{0, 3, 0, 0, 0, 100, 0, 4, 0, 0, 0, 1, 0, 2, 0, 0, 0, 0}
+	if got := mergeHTTP2Settings(base, override); string(got) != string(want) {
+		t.Fatalf("merged = %v, want %v", got, want)
+	}
+}
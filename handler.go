@@ -9,8 +9,7 @@ import (
 type HandlerFunc func(*Request)
 
 // notFoundHandler return 404 with not found message.
-func notFoundHandler(w http.ResponseWriter, r *http.Request) {
-	log.logRequest(r.URL.Path, r.Method, http.StatusNotFound)
-	http.NotFound(w, r)
+func notFoundHandler(r *Request) {
+	http.NotFound(r.Writer, r.Req)
 }
 
@@ -46,6 +46,12 @@ func isDynamicSegment(segment string) bool {
 	return strings.HasPrefix(segment, "$")
 }
 
+// isCatchAllSegment reports whether the segment matches the rest of the path,
+// e.g. "*filepath" in "/static/*filepath".
+func isCatchAllSegment(segment string) bool {
+	return strings.HasPrefix(segment, "*")
+}
+
 func isLastSegment(index int, segments []string) bool {
 	return index == len(segments)-1
 }
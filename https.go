@@ -0,0 +1,111 @@
+package rapidroot
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPSConfig configures the redirect to HTTPS and HTTP Strict Transport Security,
+// see Router.SetHTTPSConfig.
+type HTTPSConfig struct {
+	// Port of the HTTPS server used by RunRedirectToHTTPS, defaults to 443.
+	Port int
+
+	// HSTSMaxAge is the time browsers only use HTTPS for the host, the
+	// Strict-Transport-Security header is sent with HTTPS responses if it's set.
+	HSTSMaxAge time.Duration
+
+	// HSTSIncludeSubdomains applies the HSTS policy to all subdomains.
+	HSTSIncludeSubdomains bool
+
+	// HSTSPreload allows to submit the host to the HSTS preload lists of browsers.
+	HSTSPreload bool
+}
+
+// SetHTTPSConfig sets the HTTPS configuration of the router.
+//
+// Example:
+//
+//	router.SetHTTPSConfig(rr.HTTPSConfig{
+//		Port:       8443,
+//		HSTSMaxAge: 365 * 24 * time.Hour,
+//	})
+func (r *Router) SetHTTPSConfig(config HTTPSConfig) {
+	r.httpsConfig = config
+	r.hstsHeader = ""
+	if config.HSTSMaxAge > 0 {
+		r.hstsHeader = "max-age=" + strconv.FormatInt(int64(config.HSTSMaxAge/time.Second), 10)
+		if config.HSTSIncludeSubdomains {
+			r.hstsHeader += "; includeSubDomains"
+		}
+		if config.HSTSPreload {
+			r.hstsHeader += "; preload"
+		}
+	}
+}
+
+// setHSTS sets the Strict-Transport-Security header, browsers ignore it in
+// responses over plain HTTP.
+func (r *Router) setHSTS(w http.ResponseWriter, req *http.Request) {
+	if r.hstsHeader != "" && req.TLS != nil {
+		w.Header().Set("Strict-Transport-Security", r.hstsHeader)
+	}
+}
+
+// RunRedirectToHTTPS starts an HTTP server, which redirects all requests to
+// the same URL over HTTPS with 308 status code, so methods and bodies are kept.
+// The port of the HTTPS server is set by HTTPSConfig.Port. The server uses the
+// ServerConfig of the router and is shut down with the router, but it isn't
+// passed to the new process by Router.Restart.
+//
+// Example:
+//
+//	go router.RunRedirectToHTTPS(":80")
+//	err := router.RunWithTLS(":443", "cert.pem", "key.pem")
+func (r *Router) RunRedirectToHTTPS(addr string) error {
+	server := r.newServer(addr)
+	server.Handler = http.HandlerFunc(r.redirectToHTTPS)
+
+	r.serverMu.Lock()
+	if r.redirectServer != nil {
+		r.serverMu.Unlock()
+		return errors.New("the redirect server is already running")
+	}
+	r.redirectServer = server
+	r.serverMu.Unlock()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		// the failed server can be started again and isn't shut down
+		r.serverMu.Lock()
+		if r.redirectServer == server {
+			r.redirectServer = nil
+		}
+		r.serverMu.Unlock()
+		return fmt.Errorf("Couldn't start the redirect server: %w", err)
+	}
+	return nil
+}
+
+func (r *Router) redirectToHTTPS(w http.ResponseWriter, req *http.Request) {
+	if req.Host == "" {
+		http.Error(w, "missing host", http.StatusBadRequest)
+		return
+	}
+	host, _, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		// the host has no port
+		host = strings.Trim(req.Host, "[]")
+	}
+
+	if port := r.httpsConfig.Port; port != 0 && port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusPermanentRedirect)
+}
@@ -0,0 +1,134 @@
+package rapidroot
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+)
+
+// MIMEJavaScript is the media type of JSONP responses.
+const MIMEJavaScript = "application/javascript"
+
+// jsonpCallback matches valid JSONP callback names, e.g. "cb" or "app.handlers.cb".
+var jsonpCallback = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+
+// JSONCodec encodes and decodes JSON. It is used for rendering responses,
+// streams and binding request bodies, see Router.SetJSONConfig.
+type JSONCodec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	NewEncoder(w io.Writer) JSONEncoder
+}
+
+// JSONEncoder writes JSON values to an output stream, *json.Encoder implements it.
+type JSONEncoder interface {
+	Encode(v any) error
+	SetEscapeHTML(on bool)
+	SetIndent(prefix, indent string)
+}
+
+// stdJSONCodec is the JSONCodec based on encoding/json.
+type stdJSONCodec struct{}
+
+func (stdJSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdJSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (stdJSONCodec) NewEncoder(w io.Writer) JSONEncoder {
+	return json.NewEncoder(w)
+}
+
+// JSONConfig configures JSON responses and binding of the router.
+// Start from DefaultJSONConfig, since the zero value disables HTML escaping.
+type JSONConfig struct {
+	// Codec encodes and decodes JSON, defaults to encoding/json.
+	Codec JSONCodec
+
+	// Pretty indents all JSON responses with Indent. Records of streams, like
+	// Request.NDJSON and Request.SSE, aren't indented, since they must be single lines.
+	Pretty bool
+
+	// PrettyQuery indents the response if the request has "pretty" query parameter.
+	PrettyQuery bool
+
+	// Indent used for pretty responses.
+	Indent string
+
+	// EscapeHTML escapes <, > and & in JSON strings, see Request.PureJSON.
+	EscapeHTML bool
+
+	// SecurePrefix is prepended to the response by Request.SecureJSON to
+	// prevent JSON hijacking.
+	SecurePrefix string
+
+	// JSONPCallbackParam is the query parameter with the callback name of
+	// Request.JSONP.
+	JSONPCallbackParam string
+}
+
+// DefaultJSONConfig returns the JSON configuration used by NewRouter.
+func DefaultJSONConfig() JSONConfig {
+	return JSONConfig{
+		Codec:              stdJSONCodec{},
+		PrettyQuery:        true,
+		Indent:             "  ",
+		EscapeHTML:         true,
+		SecurePrefix:       "while(1);",
+		JSONPCallbackParam: "callback",
+	}
+}
+
+// SetJSONConfig sets the JSON configuration of the router.
+//
+// Example:
+//
+//	config := rr.DefaultJSONConfig()
+//	config.Codec = sonicCodec{}
+//	config.EscapeHTML = false
+//	router.SetJSONConfig(config)
+func (r *Router) SetJSONConfig(config JSONConfig) {
+	if config.Codec == nil {
+		config.Codec = stdJSONCodec{}
+	}
+	r.jsonConfig = config
+}
+
+// encodeJSON writes data to w with the router codec.
+func (r *Router) encodeJSON(w io.Writer, data any, escapeHTML bool, prefix, indent string) error {
+	encoder := r.jsonConfig.Codec.NewEncoder(w)
+	encoder.SetEscapeHTML(escapeHTML)
+	if prefix != "" || indent != "" {
+		encoder.SetIndent(prefix, indent)
+	}
+	return encoder.Encode(data)
+}
+
+// marshalJSON encodes data with the router codec and the EscapeHTML setting,
+// without indentation and the trailing newline, it's used for records of streams.
+func (r *Router) marshalJSON(data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := r.encodeJSON(&buf, data, r.jsonConfig.EscapeHTML, "", ""); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// jsonRenderer is the Renderer registered for MIMEJSON, it follows the
+// JSON configuration of the router.
+type jsonRenderer struct {
+	router *Router
+}
+
+func (j jsonRenderer) Render(w io.Writer, data any) error {
+	config := j.router.jsonConfig
+	indent := ""
+	if config.Pretty {
+		indent = config.Indent
+	}
+	return j.router.encodeJSON(w, data, config.EscapeHTML, "", indent)
+}
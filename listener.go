@@ -0,0 +1,132 @@
+package rapidroot
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemdListenFDsStart is the first file descriptor passed by systemd socket activation.
+const systemdListenFDsStart = 3
+
+// ErrNoSystemdListeners is returned by Router.RunSystemd when the process wasn't
+// started by systemd socket activation.
+var ErrNoSystemdListeners = errors.New("rapidroot: no listeners passed by systemd")
+
+// RunUnix builds the router and starts the HTTP server on the Unix domain
+// socket at path with perm permissions. A stale socket file, left by a process
+// that didn't exit cleanly, is removed, but a socket in use by a running server
+// is an error. The socket file never has more permissions than perm, and it's
+// removed on shutdown.
+//
+// Example:
+//
+//	err := router.RunUnix("/run/app/app.sock", 0o660)
+func (r *Router) RunUnix(path string, perm fs.FileMode) error {
+	// the socket of the parent process is in use after a restart
+	if listener := inheritedListener(); listener != nil {
+		return r.Serve(listener)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	listener, err := listenUnix(path, perm)
+	if err != nil {
+		return fmt.Errorf("Couldn't start the server: %w", err)
+	}
+	return r.Serve(listener)
+}
+
+// removeStaleSocket removes the socket file at path if no server accepts
+// connections on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use by another server", path)
+	}
+	return os.Remove(path)
+}
+
+// SystemdListeners returns the listeners passed by systemd socket activation
+// in the LISTEN_FDS and LISTEN_PID environment variables, in the order of the
+// socket unit. It returns no listeners if the process wasn't socket activated.
+// The variables are unset, so they aren't inherited by child processes.
+func SystemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(systemdListenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(systemdListenFDsStart+i), name)
+		// FileListener duplicates the descriptor with close-on-exec set
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("invalid systemd listener %s: %w", name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// RunSystemd builds the router and starts the HTTP server on all listeners
+// passed by systemd socket activation. It returns ErrNoSystemdListeners if the
+// process wasn't socket activated.
+//
+// Example of the socket unit, the service unit is started on the first connection:
+//
+//	[Socket]
+//	ListenStream=8080
+//
+//	[Install]
+//	WantedBy=sockets.target
+func (r *Router) RunSystemd() error {
+	listeners, err := SystemdListeners()
+	if err != nil {
+		return err
+	}
+	if len(listeners) == 0 {
+		// listeners of the parent process after a restart
+		listeners = inheritedListeners()
+	}
+	if len(listeners) == 0 {
+		return ErrNoSystemdListeners
+	}
+	return r.ServeListeners(listeners...)
+}
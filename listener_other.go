@@ -0,0 +1,22 @@
+//go:build !unix
+
+package rapidroot
+
+import (
+	"io/fs"
+	"net"
+	"os"
+)
+
+// listenUnix listens on the Unix domain socket at path with perm permissions.
+func listenUnix(path string, perm fs.FileMode) (net.Listener, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,211 @@
+//go:build linux
+
+package rapidroot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runUnix starts the router on the socket at path and returns the channel of
+// the result of RunUnix.
+func runUnix(t *testing.T, router *Router, path string, perm fs.FileMode) <-chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- router.RunUnix(path, perm) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		router.Shutdown(ctx)
+	})
+	return done
+}
+
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+// waitForSocket polls the server on the socket at path until it responds.
+func waitForSocket(t *testing.T, path string, done <-chan error) *http.Response {
+	t.Helper()
+	client := unixClient(path)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		select {
+		case err := <-done:
+			t.Fatalf("RunUnix returned %v", err)
+		default:
+		}
+		resp, err := client.Get("http://unix/ping")
+		if err == nil {
+			return resp
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newPingRouter() *Router {
+	router := NewRouter()
+	router.GET("/ping", func(req *Request) {
+		req.BINARY(http.StatusOK, []byte("pong"))
+	})
+	return router
+}
+
+func TestRunUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	router := newPingRouter()
+	done := runUnix(t, router, path, 0o600)
+
+	resp := waitForSocket(t, path, done)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "pong" {
+		t.Fatalf("body = %q", body)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("permissions = %o, want 600", perm)
+	}
+
+	if err := router.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RunUnix returned %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("socket file wasn't removed on shutdown: %v", err)
+	}
+}
+
+func TestRunUnixStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	// a server that didn't exit cleanly leaves the socket file
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	done := runUnix(t, newPingRouter(), path, 0o660)
+	waitForSocket(t, path, done).Body.Close()
+}
+
+func TestRunUnixInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	err = NewRouter().RunUnix(path, 0o660)
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("RunUnix returned %v, want in use error", err)
+	}
+}
+
+func TestRunUnixNotSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewRouter().RunUnix(path, 0o660); err == nil {
+		t.Fatal("RunUnix replaced a regular file")
+	}
+}
+
+func TestSystemdListenersOtherProcess(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	listeners, err := SystemdListeners()
+	if err != nil || len(listeners) != 0 {
+		t.Fatalf("SystemdListeners() = %v, %v, want none", listeners, err)
+	}
+}
+
+// TestSystemdListeners runs the test binary as a socket activated process,
+// since the descriptors of systemd start at 3.
+func TestSystemdListeners(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpListener.Close()
+	unixPath := filepath.Join(t.TempDir(), "admin.sock")
+	unixListener, err := net.Listen("unix", unixPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unixListener.Close()
+
+	tcpFile, _ := tcpListener.(*net.TCPListener).File()
+	defer tcpFile.Close()
+	unixFile, _ := unixListener.(*net.UnixListener).File()
+	defer unixFile.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdListenersProcess$")
+	cmd.Env = append(os.Environ(),
+		"RAPIDROOT_TEST_SYSTEMD=1",
+		"LISTEN_FDS=2",
+		"LISTEN_FDNAMES=http:admin",
+		"TEST_TCP_ADDR="+tcpListener.Addr().String(),
+		"TEST_UNIX_ADDR="+unixPath,
+	)
+	cmd.ExtraFiles = []*os.File{tcpFile, unixFile}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("socket activated process failed: %v\n%s", err, out)
+	}
+}
+
+func TestSystemdListenersProcess(t *testing.T) {
+	if os.Getenv("RAPIDROOT_TEST_SYSTEMD") != "1" {
+		t.Skip("run by TestSystemdListeners")
+	}
+	// systemd sets the pid of the service, which isn't known to the test before exec
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+
+	listeners, err := SystemdListeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 2 {
+		t.Fatalf("got %d listeners, want 2", len(listeners))
+	}
+	if got := listeners[0].Addr().String(); got != os.Getenv("TEST_TCP_ADDR") {
+		t.Fatalf("first listener = %s", got)
+	}
+	if got := listeners[1].Addr().String(); got != os.Getenv("TEST_UNIX_ADDR") {
+		t.Fatalf("second listener = %s", got)
+	}
+	for _, env := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if _, ok := os.LookupEnv(env); ok {
+			t.Fatalf("%s is inherited by child processes", env)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package rapidroot
+
+import (
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes the umask changes of listenUnix.
+var umaskMu sync.Mutex
+
+// listenUnix listens on the Unix domain socket at path, the socket file is
+// created with at most perm permissions, so it's never accessible by others
+// before it gets perm.
+func listenUnix(path string, perm fs.FileMode) (net.Listener, error) {
+	umaskMu.Lock()
+	// the umask is global, it's only made stricter for files created meanwhile
+	old := syscall.Umask(0o777)
+	syscall.Umask(old | int(^perm&fs.ModePerm))
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(old)
+	umaskMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// the umask of the process may have removed bits of perm
+	if err := os.Chmod(path, perm); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -1,21 +1,36 @@
 package rapidroot
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var log = newLogger(os.Stdout)
-
 const (
 	timeFormat          = "[2006/01/02 15:04:05]"
-	terminalInfoFormat  = "%s INFO: %s\n"
-	terminalWarnFormat  = "%s WARN: %s\n"
-	terminalErrorFormat = "%s ERROR: %s | function caller: %s\n"
+	terminalFormat      = "%s %s: %s"
+	terminalRequestFmt  = "%s %s %s %d"
+	requestLogMessage   = "request"
+	requestIDHeader     = "X-Request-ID"
+	handlerNameLogField = "handler"
+	requestLogKindField = "log"
 )
 
+// requestLogKind marks the records of served requests, so text handlers can
+// format them as access lines. Other handlers log it as "access".
+type requestLogKind struct{}
+
+func (requestLogKind) LogValue() slog.Value {
+	return slog.StringValue("access")
+}
+
 const (
 	reset = "\033[0m"
 
@@ -37,77 +52,266 @@ const (
 	white        = "\033[97m"
 )
 
-type logger struct {
-	output io.Writer
+// Logger is the logger of the router, args are alternating keys and values
+// like in log/slog. *slog.Logger implements it, see Router.SetLogger.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// defaultLoggerValue holds the logger of routers without their own logger, it's
+// replaced by SetOutput while servers may be running.
+var defaultLoggerValue atomic.Pointer[Logger]
+
+func init() {
+	SetOutput(os.Stdout)
+}
+
+// defaultLogger returns the logger used by routers without their own logger.
+func defaultLogger() Logger {
+	return *defaultLoggerValue.Load()
+}
+
+// NewLogger returns a Logger that writes records to the handler.
+func NewLogger(handler slog.Handler) Logger {
+	return slog.New(handler)
+}
+
+// NewTextLogger returns a Logger with human-readable lines, which are colored
+// if w is a terminal, unless NO_COLOR is set.
+func NewTextLogger(w io.Writer, level slog.Leveler) Logger {
+	terminal := isTerminal(w)
+	return slog.New(&terminalHandler{
+		mu:       new(sync.Mutex),
+		w:        w,
+		level:    level,
+		terminal: terminal,
+		color:    terminal && os.Getenv("NO_COLOR") == "",
+	})
+}
+
+// NewJSONLogger returns a Logger that writes JSON lines for log pipelines.
+func NewJSONLogger(w io.Writer, level slog.Leveler) Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// SetOutput sets the output of the default logger, which is used by routers
+// without a logger set by Router.SetLogger. It's safe to call it while servers
+// are running.
+func SetOutput(w io.Writer) {
+	logger := NewTextLogger(w, slog.LevelInfo)
+	defaultLoggerValue.Store(&logger)
+}
+
+// SetLogger sets the logger of the router.
+//
+// Example:
+//
+//	router.SetLogger(rr.NewJSONLogger(os.Stdout, slog.LevelInfo))
+//	// or any slog handler
+//	router.SetLogger(slog.New(handler))
+func (r *Router) SetLogger(logger Logger) {
+	r.logger = logger
+}
+
+func (r *Router) log() Logger {
+	if r.logger == nil {
+		return defaultLogger()
+	}
+	return r.logger
+}
+
+// logError logs the error of the request with the handler name.
+func (r *Request) logError(msg string, args ...any) {
+	args = append(args, handlerNameLogField, r.handlerName)
+	if r.router == nil {
+		defaultLogger().Error(msg, args...)
+		return
+	}
+	r.router.log().Error(msg, args...)
 }
 
-func newLogger(output io.Writer) *logger {
-	return &logger{output: output}
+// logRequest logs the served request.
+func (r *Router) logRequest(req *http.Request, status int, latency time.Duration, handlerName string) {
+	r.log().Info(requestLogMessage,
+		requestLogKindField, requestLogKind{},
+		"method", req.Method,
+		"path", req.URL.Path,
+		"status", status,
+		"latency", latency,
+		handlerNameLogField, handlerName,
+		"request_id", req.Header.Get(requestIDHeader),
+	)
 }
 
-func (l *logger) log(msg string) {
-	fmt.Fprint(l.output, msg)
+// logRoutes prints the route table to text loggers writing to a terminal, other
+// loggers get it on debug level.
+func (r *Router) logRoutes(table string) {
+	if handler := terminalHandlerOf(r.log()); handler != nil && handler.terminal {
+		if handler.color {
+			table = colorize(lightCyan, table)
+		}
+		handler.write(table)
+		return
+	}
+	r.log().Debug("routes", "table", table)
 }
 
 func colorize(colorCode string, s string) string {
 	return fmt.Sprintf("%s%s%s", colorCode, s, reset)
 }
 
-func (l *logger) info(msg string) {
-	formattedMsg := fmt.Sprintf(terminalInfoFormat, time.Now().Format(timeFormat), msg)
-	if l.output == os.Stdout {
-		formattedMsg = colorize(lightCyan, formattedMsg)
+// isTerminal reports whether w is a character device.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
 	}
-	l.log(formattedMsg)
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-func (l *logger) warn(msg string) {
-	formattedMsg := fmt.Sprintf(terminalWarnFormat, time.Now().Format(timeFormat), msg)
-	if l.output == os.Stdout {
-		formattedMsg = colorize(lightOrange, formattedMsg)
-	}
-	l.log(formattedMsg)
+// terminalHandler is the slog.Handler of NewTextLogger, it keeps the format of
+// the lines short for reading in a terminal.
+type terminalHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	// terminal is set if w is a terminal, color if the lines are colored
+	terminal bool
+	color    bool
+	attrs    []slog.Attr
+	groups   []string
 }
 
-func (l *logger) error(msg, handlerName string) {
-	formattedMsg := fmt.Sprintf(terminalErrorFormat, time.Now().Format(timeFormat), msg, handlerName)
-	if l.output == os.Stdout {
-		formattedMsg = colorize(red, formattedMsg)
+func terminalHandlerOf(logger Logger) *terminalHandler {
+	slogger, ok := logger.(*slog.Logger)
+	if !ok {
+		return nil
 	}
-	l.log(formattedMsg)
+	handler, _ := slogger.Handler().(*terminalHandler)
+	return handler
 }
 
-func (l *logger) fatal(err error) {
-	l.log(colorize(lightRed, err.Error()+"\n"))
-	os.Exit(1)
+func (h *terminalHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *terminalHandler) Handle(_ context.Context, record slog.Record) error {
+	attrs := make([]slog.Attr, 0, len(h.attrs)+record.NumAttrs())
+	attrs = append(attrs, h.attrs...)
+	prefix := strings.Join(h.groups, ".")
+	isRequest := false
+	record.Attrs(func(attr slog.Attr) bool {
+		if _, ok := attr.Value.Any().(requestLogKind); ok {
+			isRequest = true
+			return true
+		}
+		if prefix != "" {
+			attr.Key = prefix + "." + attr.Key
+		}
+		attrs = append(attrs, attr)
+		return true
+	})
+
+	timestamp := record.Time.Format(timeFormat)
+	if isRequest {
+		return h.handleRequest(timestamp, attrs)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, terminalFormat, timestamp, record.Level.String(), record.Message)
+	for _, attr := range attrs {
+		fmt.Fprintf(&b, " %s=%v", attr.Key, attr.Value.Any())
+	}
+	b.WriteString("\n")
+
+	line := b.String()
+	if h.color {
+		switch {
+		case record.Level >= slog.LevelError:
+			line = colorize(red, line)
+		case record.Level >= slog.LevelWarn:
+			line = colorize(lightOrange, line)
+		case record.Level >= slog.LevelInfo:
+			line = colorize(lightCyan, line)
+		default:
+			line = colorize(darkGray, line)
+		}
+	}
+	h.write(line)
+	return nil
 }
 
-func (l *logger) logRequest(path, method string, status int) {
-	logString := fmt.Sprintf("%s %s %s %d\n", time.Now().Format(timeFormat), method, path, status)
-	if l.output == os.Stdout {
+// handleRequest formats request records as "[time] METHOD /path STATUS latency".
+func (h *terminalHandler) handleRequest(timestamp string, attrs []slog.Attr) error {
+	var method, path string
+	var status int
+	var latency time.Duration
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "method":
+			method = attr.Value.String()
+		case "path":
+			path = attr.Value.String()
+		case "status":
+			status = int(attr.Value.Int64())
+		case "latency":
+			latency = attr.Value.Duration()
+		}
+	}
+
+	line := fmt.Sprintf(terminalRequestFmt, timestamp, method, path, status)
+	if latency > 0 {
+		line += " " + latency.String()
+	}
+	line += "\n"
+	if h.color {
 		switch {
 		case status >= 100 && status < 200:
-			logString = colorize(yellow, logString)
+			line = colorize(yellow, line)
 		case status >= 200 && status < 300:
-			logString = colorize(green, logString)
+			line = colorize(green, line)
 		case status >= 300 && status < 400:
-			logString = colorize(orange, logString)
+			line = colorize(orange, line)
 		case status >= 400 && status < 500:
-			logString = colorize(cyan, logString)
+			line = colorize(cyan, line)
 		case status >= 500 && status < 600:
-			logString = colorize(red, logString)
+			line = colorize(red, line)
 		default:
-			logString = colorize(white, logString)
+			line = colorize(white, line)
 		}
 	}
-	l.log(logString)
+	h.write(line)
+	return nil
 }
 
-func SetOutput(w io.Writer) {
-	log.output = w
+func (h *terminalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	prefix := strings.Join(h.groups, ".")
+	clone.attrs = append(make([]slog.Attr, 0, len(h.attrs)+len(attrs)), h.attrs...)
+	for _, attr := range attrs {
+		if prefix != "" {
+			attr.Key = prefix + "." + attr.Key
+		}
+		clone.attrs = append(clone.attrs, attr)
+	}
+	return &clone
+}
+
+func (h *terminalHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.groups = append(append(make([]string, 0, len(h.groups)+1), h.groups...), name)
+	return &clone
 }
 
-func logHandlers(s string) {
-	colorized := colorize(lightCyan, s)
-	log.log(colorized)
+func (h *terminalHandler) write(s string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	io.WriteString(h.w, s)
 }
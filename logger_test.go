@@ -0,0 +1,30 @@
+package rapidroot
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTextLoggerRequestRecords checks that only the records of served
+// requests are formatted as access lines.
+func TestTextLoggerRequestRecords(t *testing.T) {
+	var buf bytes.Buffer
+	router := NewRouter()
+	router.SetLogger(NewTextLogger(&buf, slog.LevelInfo))
+
+	router.log().Info("request", "user", "gopher")
+	if line := buf.String(); !strings.Contains(line, "INFO: request user=gopher") {
+		t.Fatalf("user record was logged as %q", line)
+	}
+
+	buf.Reset()
+	router.logRequest(httptest.NewRequest(http.MethodGet, "/users", nil), http.StatusOK, time.Millisecond, "users")
+	if line := buf.String(); !strings.Contains(line, " GET /users 200 1ms") || strings.Contains(line, "log=") {
+		t.Fatalf("request record was logged as %q", line)
+	}
+}
@@ -45,12 +45,12 @@ func (r *Router) GroupMiddleware(method, path string, middleware ...Middleware)
 // The middleware1 and middleware2 will be applied to usersHandler
 func (r *Router) Middleware(method, path string, middleware ...Middleware) {
 	root := r.getOrCreateRoot(method)
-	node := getNode(path, root, nil)
-	if node == nil {
-		addMiddlewareOrGroupToTree(cleanPath(path), root, middleware, false)
-	} else {
-		node.currentNodeMiddleware = append(node.currentNodeMiddleware, middleware...)
+	path = cleanPath(path)
+	if path == "/" {
+		path = ""
 	}
+	// the node of the route is found like by handle, not by matching the path
+	addMiddlewareOrGroupToTree(path, root, middleware, false)
 }
 
 func addMiddlewareOrGroupToTree(path string, root *node, middleware []Middleware, isGroup bool) {
@@ -58,7 +58,7 @@ func addMiddlewareOrGroupToTree(path string, root *node, middleware []Middleware
 	currentNode := root
 
 	for i, segment := range segments {
-		childNode := currentNode.child(segment)
+		childNode := currentNode.routeChild(segment)
 
 		if childNode == nil {
 			childNode = newNode()
@@ -73,6 +73,11 @@ func addMiddlewareOrGroupToTree(path string, root *node, middleware []Middleware
 			currentNode.pathSegment = segment[1:]
 		}
 
+		if isCatchAllSegment(segment) {
+			currentNode.isCatchAll = true
+			currentNode.pathSegment = segment[1:]
+		}
+
 		if i == len(segments)-1 {
 			if isGroup {
 				currentNode.groupMiddleware = append(currentNode.groupMiddleware, middleware...)
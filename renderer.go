@@ -0,0 +1,148 @@
+package rapidroot
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Media types of the renderers registered by NewRouter.
+const (
+	MIMEJSON  = "application/json"
+	MIMEXML   = "application/xml"
+	MIMEPlain = "text/plain"
+	MIMEHTML  = "text/html"
+)
+
+// Renderer encodes data to the response body. Renderers are registered on the
+// router by media type, see Router.RegisterRenderer.
+type Renderer interface {
+	Render(w io.Writer, data any) error
+}
+
+// RendererFunc is an adapter to allow the use of ordinary functions as a Renderer.
+type RendererFunc func(w io.Writer, data any) error
+
+// Render calls f(w, data).
+func (f RendererFunc) Render(w io.Writer, data any) error {
+	return f(w, data)
+}
+
+type xmlRenderer struct{}
+
+func (xmlRenderer) Render(w io.Writer, data any) error {
+	return xml.NewEncoder(w).Encode(data)
+}
+
+type plainRenderer struct{}
+
+func (plainRenderer) Render(w io.Writer, data any) error {
+	var err error
+	switch v := data.(type) {
+	case []byte:
+		_, err = w.Write(v)
+	case string:
+		_, err = io.WriteString(w, v)
+	default:
+		_, err = fmt.Fprint(w, v)
+	}
+	return err
+}
+
+// RegisterRenderer registers renderer for the mediaType, replacing the previous one if any.
+// Registered renderers are used by Request.Render and Request.Negotiate.
+//
+// Example:
+//
+//	router.RegisterRenderer("text/csv", rr.RendererFunc(func(w io.Writer, data any) error {
+//		return csv.NewWriter(w).WriteAll(data.([][]string))
+//	}))
+func (r *Router) RegisterRenderer(mediaType string, renderer Renderer) {
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if _, ok := r.renderers[mediaType]; !ok {
+		r.rendererOrder = append(r.rendererOrder, mediaType)
+	}
+	r.renderers[mediaType] = renderer
+}
+
+func (r *Router) registerDefaultRenderers() {
+	r.RegisterRenderer(MIMEJSON, jsonRenderer{router: r})
+	r.RegisterRenderer(MIMEXML, xmlRenderer{})
+	r.RegisterRenderer(MIMEPlain, plainRenderer{})
+}
+
+func (r *Router) renderer(mediaType string) Renderer {
+	return r.renderers[strings.ToLower(mediaType)]
+}
+
+// acceptRange is a single media range of the Accept header.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(header string) []acceptRange {
+	ranges := make([]acceptRange, 0)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(key) != "q" {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				q = parsed
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// matchRange returns the specificity of the match between mediaType and the
+// accept range, or -1 if they don't match.
+func matchRange(accept, mediaType string) int {
+	switch {
+	case accept == mediaType:
+		return 2
+	case accept == "*/*":
+		return 0
+	case strings.HasSuffix(accept, "/*") && strings.HasPrefix(mediaType, accept[:len(accept)-1]):
+		return 1
+	}
+	return -1
+}
+
+// negotiateMediaType returns the offer that is preferred by the Accept header.
+// If header is empty the first offer is returned, if nothing is acceptable
+// the empty string is returned.
+func negotiateMediaType(header string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(header) == "" {
+		return offers[0]
+	}
+
+	ranges := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, accept := range ranges {
+			if s := matchRange(accept.mediaType, offer); s > specificity {
+				q, specificity = accept.q, s
+			}
+		}
+		if specificity >= 0 && q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
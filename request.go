@@ -1,18 +1,28 @@
 package rapidroot
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"net/url"
 	"sync"
 )
 
 // Request is a struct for handlers, to interact with request.
+//
+// Requests are pooled and reused for other requests after the handler returns,
+// so a *Request and its values must not be retained or used by goroutines
+// that outlive the handler. Copy what is needed instead, e.g. req.Value("id")
+// or req.Req.Context().
 type Request struct {
 	Writer http.ResponseWriter
 	Req    *http.Request
 
+	// router that is serving the request
+	router *Router
+
 	// used to prevent usage of the shared memory of the data by multiple goroutines
 	mu *sync.Mutex
 
@@ -30,65 +40,89 @@ type Request struct {
 
 	// used to abort request
 	isAborted bool
+
+	// body cached by Body, bodyErr is the error of reading it and rawBody is
+	// the original Req.Body without limits
+	body    []byte
+	bodyErr error
+	rawBody io.ReadCloser
+
+	// bodyLimit is the limit of the router or of the BodyLimit middleware of the route
+	bodyLimit int64
+
+	// streams started by the handler, they are closed when the handler returns,
+	// so their goroutines don't write to the released request
+	streams []io.Closer
 }
 
-var requestPool sync.Pool
+var requestPool = sync.Pool{
+	New: func() interface{} {
+		return newPooledRequest()
+	},
+}
 
-func init() {
-	requestPool = sync.Pool{
-		New: func() interface{} {
-			return &Request{}
-		},
+// newPooledRequest returns a Request with the state, which is reused by the pool.
+func newPooledRequest() *Request {
+	request := &Request{
+		mu:     new(sync.Mutex),
+		data:   make(map[string]any),
+		cookie: new(cookies),
 	}
+	request.cookie.reset()
+	return request
 }
 
 // GetRequest retrieves a Request from the sync pool.
-func getRequest(w http.ResponseWriter, req *http.Request) *Request {
+func getRequest(router *Router, w http.ResponseWriter, req *http.Request) *Request {
 	request := requestPool.Get().(*Request)
+	request.router = router
 	request.Writer = w
 	request.Req = req
-	request.data = make(map[string]any)
 	request.queryValues = req.URL.Query()
 
 	return request
 }
 
+// reset clears the request for the next use, the mutex, the data map and the
+// cookie defaults are kept to be reused.
 func (r *Request) reset() {
 	r.Writer = nil
 	r.Req = nil
-	r.data = nil
+	r.router = nil
+	clear(r.data)
 	r.queryValues = nil
-	r.cookie = nil
+	r.cookie.reset()
 	r.handlerName = ""
 	r.isAborted = false
+	r.body = nil
+	r.bodyErr = nil
+	r.rawBody = nil
+	r.bodyLimit = 0
+	clear(r.streams)
+	r.streams = r.streams[:0]
 }
 
 // ReleaseRequest releases a Request back to the sync pool.
 func releaseRequest(request *Request) {
+	request.closeStreams()
 	request.reset()
 	requestPool.Put(request)
 }
-func newRequest(writer http.ResponseWriter, req *http.Request) *Request {
-	// Initialize a new Request struct
-	newRequest := &Request{
-		Writer:      writer,
-		Req:         req,
-		mu:          new(sync.Mutex),
-		data:        make(map[string]interface{}),
-		queryValues: req.URL.Query(),
-		cookie: &cookies{
-			defaults: &http.Cookie{
-				HttpOnly: true,
-				Secure:   true,
-				SameSite: http.SameSiteStrictMode,
-				Path:     "/",
-			},
-		},
-		handlerName: "",
-		isAborted:   false,
+
+// closeStreams closes the streams, which the handler didn't close.
+func (r *Request) closeStreams() {
+	for _, stream := range r.streams {
+		stream.Close()
 	}
+}
+
+func newRequest(writer http.ResponseWriter, req *http.Request) *Request {
+	request := newPooledRequest()
+	request.Writer = writer
+	request.Req = req
+	request.queryValues = req.URL.Query()
 
-	return newRequest
+	return request
 }
 
 /*
@@ -118,7 +152,10 @@ func (r *Request) SetStatus(code int) {
 }
 
 func (r *Request) GetStatus() int {
-	return r.Writer.(*responseCodeWrapper).statusCode
+	if resp := unwrapCodeWrapper(r.Writer); resp != nil {
+		return resp.statusCode
+	}
+	return 0
 }
 
 // QueryValue returns value from query.
@@ -132,7 +169,12 @@ func (r *Request) QueryValues() url.Values {
 }
 
 // PostFormValues returns all values from post form.
+// The form is parsed if it isn't parsed yet, multipart forms with 32MB of memory.
 func (r *Request) PostFormValues() url.Values {
+	if r.Req.PostForm == nil {
+		// parses url-encoded forms as well, returning http.ErrNotMultipart
+		r.Req.ParseMultipartForm(defaultMultipartMemory)
+	}
 	return r.Req.PostForm
 }
 
@@ -170,10 +212,54 @@ func (r *Request) ERROR(code int, err error) {
 }
 
 // JSON parses data to json format and sends response with a provided code.
+// The response is indented if the router is configured to be pretty or the
+// request has "pretty" query parameter, see Router.SetJSONConfig.
 func (r *Request) JSON(code int, data any) {
 	r.writeJSON(code, data)
 }
 
+// JSONIndent parses data to indented json format and sends response with a provided code.
+func (r *Request) JSONIndent(code int, data any, prefix, indent string) {
+	r.writeJSONIndent(code, data, prefix, indent)
+}
+
+// PureJSON same as JSON, but doesn't escape HTML characters like < and >.
+func (r *Request) PureJSON(code int, data any) {
+	r.writePureJSON(code, data)
+}
+
+// SecureJSON same as JSON, but prepends the secure prefix of the router
+// configuration, "while(1);" by default, to prevent JSON hijacking.
+func (r *Request) SecureJSON(code int, data any) {
+	r.writeSecureJSON(code, data)
+}
+
+// JSONP wraps json data in a call of the callback from the "callback" query
+// parameter, the parameter name is configurable by Router.SetJSONConfig.
+// If there is no callback, it sends plain JSON.
+// If the callback isn't a valid JavaScript identifier, it will abort with a 400 error status code.
+func (r *Request) JSONP(code int, data any) {
+	callback := r.QueryValue(r.router.jsonConfig.JSONPCallbackParam)
+	if callback == "" {
+		r.writeJSON(code, data)
+		return
+	}
+	if !jsonpCallback.MatchString(callback) {
+		r.abortWithErr(http.StatusBadRequest, errors.New("invalid JSONP callback"))
+		return
+	}
+	r.writeJSONP(code, callback, data)
+}
+
+// BindJSON decodes the JSON body of the request into v with the codec of the router.
+func (r *Request) BindJSON(v any) error {
+	body, err := r.Body()
+	if err != nil {
+		return err
+	}
+	return r.router.jsonConfig.Codec.Unmarshal(body, v)
+}
+
 // XML parses data to xml format and sends response with a provided code.
 func (r *Request) XML(code int, data any) {
 	r.writeXML(code, data)
@@ -184,23 +270,61 @@ func (r *Request) XMLIndent(code int, data any, prefix, indent string) {
 	r.writeXMLIndent(code, data, prefix, indent)
 }
 
+// Render encodes data with the renderer registered for the mediaType and sends
+// response with a provided code.
+// If there is no renderer for the mediaType, it will abort with a 500 error status code.
+func (r *Request) Render(code int, mediaType string, data any) {
+	r.writeRendered(code, mediaType, data)
+}
+
+// Negotiate encodes data with the registered renderer that best matches the
+// Accept header of the request and sends response with a provided code.
+// If none of the registered media types is acceptable, it responds with 406.
+func (r *Request) Negotiate(code int, data any) {
+	mediaType := negotiateMediaType(r.Req.Header.Get("Accept"), r.router.rendererOrder)
+	if mediaType == "" {
+		r.abortWithErr(http.StatusNotAcceptable, errors.New(http.StatusText(http.StatusNotAcceptable)))
+		return
+	}
+	r.Writer.Header().Add("Vary", "Accept")
+	r.writeRendered(code, mediaType, data)
+}
+
 // HTML parses data to HTML format and sends a response with the provided code.
-// If there is no file with such name, it will abort with a 500 error status code.
+// If templates are loaded by Router.LoadTemplates, name is the path of the page
+// relative to the templates directory, otherwise the file is parsed on each call.
+// If there is no template with such name, it will abort with a 500 error status code.
 func (r *Request) HTML(code int, name string, data any) {
+	if templates := r.router.templates.Load(); templates != nil {
+		if err := r.router.templateErr.Load(); err != nil {
+			r.logError("templates failed to reload", "error", *err)
+			r.internalError(*err)
+			return
+		}
+		tmpl, execName, ok := templates.lookup(name)
+		if !ok {
+			r.logError("template doesn't exist", "template", name)
+			r.internalError(fmt.Errorf("template: %s doesn't exist", name))
+			return
+		}
+		r.writeHTMLTemplate(code, execName, tmpl, data)
+		return
+	}
+
 	if !fileExists(name) {
 		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
-		log.error(fmt.Sprintf("File: %s doesn't exist", name), r.handlerName)
+		r.logError("file doesn't exist", "file", name)
 		return
 	}
 
 	tmpl, err := template.ParseFiles(name)
 	if err != nil {
-		log.error(fmt.Sprintf("Failed to parse HTML file: %s, err: %s", name, err.Error()), r.handlerName)
-		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
+		r.logError("failed to parse HTML file", "file", name, "error", err)
+		r.internalError(err)
 		return
 	}
 
-	r.writeHTML(code, *tmpl, data)
+	r.writeHTML(code, tmpl, data)
 }
 
 // HTMLTemplate same as HTML, but you can put your html template to execute.
@@ -218,11 +342,11 @@ func (r *Request) HTML(code int, name string, data any) {
 // If there is no file with such name, will abort with 500 error status code.
 func (r *Request) HTMLTemplate(code int, templateName string, tmpl *template.Template, data any) {
 	if templateName == "" {
-		log.error("templateName is empty", r.handlerName)
+		r.logError("templateName is empty")
 		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
 		return
 	}
-	r.writeHTMLTemplate(code, templateName, *tmpl, data)
+	r.writeHTMLTemplate(code, templateName, tmpl, data)
 }
 
 // BINARY response with binary data and provided code.
@@ -230,12 +354,30 @@ func (r *Request) BINARY(code int, data []byte) {
 	r.writeBINARY(code, data)
 }
 
-// FILE response with file and provided code.
+// FILE responds with the file as an attachment and provided code.
+// With 200 code the file supports Range and conditional requests, the status
+// is then chosen by the request headers (206, 304, 412, 416).
+// If there is no file with such name, it will abort with a 404 error status code.
 func (r *Request) FILE(code int, fileName string) {
-	if !fileExists(fileName) {
-		log.error(fmt.Sprintf("File: %s doesn't exist", fileName), r.handlerName)
-		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
-		return
-	}
-	r.writeFILE(code, fileName)
+	r.writeFILE(code, fileName, dispositionAttachment, "")
+}
+
+// Attachment responds with the file, which the browser downloads as downloadName.
+// If downloadName is empty, the base name of the file is used.
+// Range and conditional requests are supported.
+func (r *Request) Attachment(fileName, downloadName string) {
+	r.writeFILE(http.StatusOK, fileName, dispositionAttachment, downloadName)
+}
+
+// Inline responds with the file, which the browser displays as displayName.
+// If displayName is empty, the base name of the file is used.
+// Range and conditional requests are supported.
+func (r *Request) Inline(fileName, displayName string) {
+	r.writeFILE(http.StatusOK, fileName, dispositionInline, displayName)
+}
+
+// ServeFile responds with the file without Content-Disposition header.
+// Range and conditional requests are supported.
+func (r *Request) ServeFile(fileName string) {
+	r.writeFILE(http.StatusOK, fileName, "", "")
 }
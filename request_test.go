@@ -0,0 +1,93 @@
+package rapidroot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPooledRequests serves requests concurrently, so the state of pooled
+// requests must not leak into the next request. Run it with -race.
+func TestPooledRequests(t *testing.T) {
+	router := NewRouter()
+	router.GET("/users/$id/profile", func(req *Request) {
+		id, _ := req.Value("id").(string)
+		req.SetValue("user"+id, id)
+		if req.Req.URL.Query().Has("insecure") {
+			req.SetCookiesSecure(false)
+			req.SetCookiePath("/users")
+		}
+		req.SetCookie("session", id, time.Time{})
+		req.JSON(http.StatusOK, map[string]any{
+			"id":     id,
+			"values": req.Values(),
+		})
+	})
+	if err := router.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, requests = 8, 200
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				id := fmt.Sprintf("%d-%d", w, i)
+				insecure := i%2 == 0
+				target := "/users/" + id + "/profile"
+				if insecure {
+					target += "?insecure=1"
+				}
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+				if err := checkPooledResponse(rec, id, insecure); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func checkPooledResponse(rec *httptest.ResponseRecorder, id string, insecure bool) error {
+	var body struct {
+		ID     string            `json:"id"`
+		Values map[string]string `json:"values"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		return err
+	}
+	if body.ID != id {
+		return fmt.Errorf("param id = %q, want %q", body.ID, id)
+	}
+	// the path parameter is a value too
+	if len(body.Values) != 2 || body.Values["id"] != id || body.Values["user"+id] != id {
+		return fmt.Errorf("request %s has values %v", id, body.Values)
+	}
+
+	cookie := rec.Header().Get("Set-Cookie")
+	if !strings.HasPrefix(cookie, "session="+id+";") {
+		return fmt.Errorf("request %s set cookie %q", id, cookie)
+	}
+	// the defaults changed by the previous request must be reset
+	if secure := strings.Contains(cookie, "; Secure"); secure == insecure {
+		return fmt.Errorf("request %s set cookie %q, insecure %v", id, cookie, insecure)
+	}
+	if path := strings.Contains(cookie, "Path=/users;"); path != insecure {
+		return fmt.Errorf("request %s set cookie %q, insecure %v", id, cookie, insecure)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package rapidroot
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// responseCodeWrapper records the status code, the number of bytes written and
+// the time of the first write of the response. It supports
+// http.ResponseController through Unwrap, the writer returned by
+// newResponseCodeWrapper implements only the optional interfaces implemented
+// by the underlying writer, so type assertions don't succeed for no-ops.
+type responseCodeWrapper struct {
+	http.ResponseWriter
+	statusCode   int
+	bytesWritten int64
+	firstWrite   time.Time
+	logger       Logger
+}
+
+// newResponseCodeWrapper wraps w, the returned writer implements http.Flusher,
+// http.Hijacker, http.Pusher and io.ReaderFrom only if w implements them.
+func newResponseCodeWrapper(w http.ResponseWriter, logger Logger) http.ResponseWriter {
+	base := &responseCodeWrapper{ResponseWriter: w, logger: logger}
+	f := flushWriter{base}
+	h := hijackWriter{base}
+	p := pushWriter{base}
+	rf := readFromWriter{base}
+
+	_, canFlush := w.(http.Flusher)
+	_, canHijack := w.(http.Hijacker)
+	_, canPush := w.(http.Pusher)
+	_, canReadFrom := w.(io.ReaderFrom)
+	switch {
+	case canFlush && canHijack && canPush && canReadFrom:
+		return struct {
+			*responseCodeWrapper
+			flushWriter
+			hijackWriter
+			pushWriter
+			readFromWriter
+		}{base, f, h, p, rf}
+	case canFlush && canHijack && canPush:
+		return struct {
+			*responseCodeWrapper
+			flushWriter
+			hijackWriter
+			pushWriter
+		}{base, f, h, p}
+	case canFlush && canHijack && canReadFrom:
+		return struct {
+			*responseCodeWrapper
+			flushWriter
+			hijackWriter
+			readFromWriter
+		}{base, f, h, rf}
+	case canFlush && canPush && canReadFrom:
+		return struct {
+			*responseCodeWrapper
+			flushWriter
+			pushWriter
+			readFromWriter
+		}{base, f, p, rf}
+	case canHijack && canPush && canReadFrom:
+		return struct {
+			*responseCodeWrapper
+			hijackWriter
+			pushWriter
+			readFromWriter
+		}{base, h, p, rf}
+	case canFlush && canHijack:
+		return struct {
+			*responseCodeWrapper
+			flushWriter
+			hijackWriter
+		}{base, f, h}
+	case canFlush && canPush:
+		return struct {
+			*responseCodeWrapper
+			flushWriter
+			pushWriter
+		}{base, f, p}
+	case canFlush && canReadFrom:
+		return struct {
+			*responseCodeWrapper
+			flushWriter
+			readFromWriter
+		}{base, f, rf}
+	case canHijack && canPush:
+		return struct {
+			*responseCodeWrapper
+			hijackWriter
+			pushWriter
+		}{base, h, p}
+	case canHijack && canReadFrom:
+		return struct {
+			*responseCodeWrapper
+			hijackWriter
+			readFromWriter
+		}{base, h, rf}
+	case canPush && canReadFrom:
+		return struct {
+			*responseCodeWrapper
+			pushWriter
+			readFromWriter
+		}{base, p, rf}
+	case canFlush:
+		return struct {
+			*responseCodeWrapper
+			flushWriter
+		}{base, f}
+	case canHijack:
+		return struct {
+			*responseCodeWrapper
+			hijackWriter
+		}{base, h}
+	case canPush:
+		return struct {
+			*responseCodeWrapper
+			pushWriter
+		}{base, p}
+	case canReadFrom:
+		return struct {
+			*responseCodeWrapper
+			readFromWriter
+		}{base, rf}
+	}
+	return base
+}
+
+// unwrapCodeWrapper returns the wrapper of the writer returned by
+// newResponseCodeWrapper, or nil if w isn't one.
+func unwrapCodeWrapper(w http.ResponseWriter) *responseCodeWrapper {
+	if wrapper, ok := w.(interface{ codeWrapper() *responseCodeWrapper }); ok {
+		return wrapper.codeWrapper()
+	}
+	return nil
+}
+
+func (w *responseCodeWrapper) codeWrapper() *responseCodeWrapper {
+	return w
+}
+
+func (w *responseCodeWrapper) WriteHeader(statusCode int) {
+	// informational responses may be sent before the final status
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.statusCode != 0 {
+		w.logger.Warn("Couldn't change status of the response, it had already been changed",
+			"status", w.statusCode, "new_status", statusCode)
+		return
+	}
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseCodeWrapper) Write(data []byte) (int, error) {
+	w.beforeWrite()
+	n, err := w.ResponseWriter.Write(data)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+// FlushError is used by http.ResponseController, it returns http.ErrNotSupported
+// if the underlying writer can't flush.
+func (w *responseCodeWrapper) FlushError() error {
+	w.beforeWrite()
+	switch flusher := w.ResponseWriter.(type) {
+	case interface{ FlushError() error }:
+		return flusher.FlushError()
+	case http.Flusher:
+		flusher.Flush()
+		return nil
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *responseCodeWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// beforeWrite records the implicit 200 status and the time of the first write.
+func (w *responseCodeWrapper) beforeWrite() {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	if w.firstWrite.IsZero() {
+		w.firstWrite = time.Now()
+	}
+}
+
+// flushWriter implements http.Flusher for writers that can flush.
+type flushWriter struct {
+	w *responseCodeWrapper
+}
+
+// Flush sends any buffered data to the client.
+func (f flushWriter) Flush() {
+	f.w.FlushError()
+}
+
+// hijackWriter implements http.Hijacker for writers that can be hijacked.
+type hijackWriter struct {
+	w *responseCodeWrapper
+}
+
+// Hijack lets the caller take over the connection. The status is set to 101,
+// since the response is no longer written by the server.
+func (h hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := h.w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && h.w.statusCode == 0 {
+		h.w.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// pushWriter implements http.Pusher for HTTP/2 writers.
+type pushWriter struct {
+	w *responseCodeWrapper
+}
+
+// Push initiates an HTTP/2 server push.
+func (p pushWriter) Push(target string, opts *http.PushOptions) error {
+	return p.w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// readFromWriter implements io.ReaderFrom, so io.Copy uses the sendfile
+// optimization of the underlying writer.
+type readFromWriter struct {
+	w *responseCodeWrapper
+}
+
+func (rf readFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	rf.w.beforeWrite()
+	n, err := rf.w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	rf.w.bytesWritten += n
+	return n, err
+}
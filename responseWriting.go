@@ -1,143 +1,171 @@
 package rapidroot
 
 import (
-	"bytes"
-	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
+	"strconv"
 )
 
-func (r *Request) writeJSON(code int, data any) {
+// write is the shared path of all response writers. The body is encoded into
+// a pooled buffer first, so if encode fails nothing is sent yet and the request
+// is aborted with a clean 500. Otherwise Content-Type, Content-Length and the
+// status code are set and the buffer is written.
+func (r *Request) write(code int, contentType string, encode func(w io.Writer) error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.SetStatus(code)
-	err := json.NewEncoder(r.Writer).Encode(data)
-	if err != nil {
-		log.error(fmt.Sprint("failed to convert data to JSON: %w", err), r.handlerName)
-		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
-		return
-	}
-}
-
-func (r *Request) writeXML(code int, data any) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	buf := getBuffer()
+	defer putBuffer(buf)
 
-	xmlData, err := xml.Marshal(data)
-	if err != nil {
-		log.error(fmt.Sprint("failed to convert data to XML: %w", err), r.handlerName)
-		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
+	if err := encode(buf); err != nil {
+		r.logError("failed to write response", "content_type", contentType, "error", err)
+		r.internalError(err)
 		return
 	}
 
-	r.Writer.Header().Set("Content-Type", "application/xml")
+	header := r.Writer.Header()
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Length", strconv.Itoa(buf.Len()))
 	r.SetStatus(code)
-	_, err = r.Writer.Write(xmlData)
-	if err != nil {
-		log.error(err.Error(), r.handlerName)
-		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
-		return
+	if _, err := buf.WriteTo(r.Writer); err != nil {
+		r.logError("failed to write response", "content_type", contentType, "error", err)
 	}
 }
 
-func (r *Request) writeXMLIndent(code int, data any, prefix, indent string) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	xmlData, err := xml.MarshalIndent(data, prefix, indent)
-	if err != nil {
-		log.error(fmt.Sprint("failed to convert data to XML: %w", err), r.handlerName)
+// writeRendered writes data with the renderer registered for the mediaType.
+func (r *Request) writeRendered(code int, mediaType string, data any) {
+	renderer := r.router.renderer(mediaType)
+	if renderer == nil {
+		r.logError("no renderer registered for media type", "media_type", mediaType)
 		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
 		return
 	}
+	r.write(code, mediaType, func(w io.Writer) error {
+		return renderer.Render(w, data)
+	})
+}
 
-	r.Writer.Header().Set("Content-Type", "application/xml")
-	r.SetStatus(code)
-	_, err = r.Writer.Write(xmlData)
-	if err != nil {
-		log.error(err.Error(), r.handlerName)
-		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
+func (r *Request) writeJSON(code int, data any) {
+	config := r.router.jsonConfig
+	if config.PrettyQuery && r.queryValues.Has("pretty") {
+		r.writeJSONIndent(code, data, "", config.Indent)
 		return
 	}
+	r.writeRendered(code, MIMEJSON, data)
 }
 
-func (r *Request) writeHTML(code int, templ template.Template, data any) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// jsonIndent returns the indent of JSON responses set by JSONConfig.Pretty or
+// requested by the "pretty" query parameter.
+func (r *Request) jsonIndent() string {
+	config := r.router.jsonConfig
+	if config.Pretty || (config.PrettyQuery && r.queryValues.Has("pretty")) {
+		return config.Indent
+	}
+	return ""
+}
+
+func (r *Request) writeJSONIndent(code int, data any, prefix, indent string) {
+	r.write(code, MIMEJSON, func(w io.Writer) error {
+		return r.router.encodeJSON(w, data, r.router.jsonConfig.EscapeHTML, prefix, indent)
+	})
+}
 
-	r.Writer.Header().Set("Content-Type", "text/html")
+func (r *Request) writePureJSON(code int, data any) {
+	r.write(code, MIMEJSON, func(w io.Writer) error {
+		return r.router.encodeJSON(w, data, false, "", r.jsonIndent())
+	})
+}
 
-	r.SetStatus(code)
-	err := templ.Execute(r.Writer, data)
-	if err != nil {
-		log.error(fmt.Sprint("failed to execute HTML template: %w", err), r.handlerName)
-		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
-		return
-	}
+func (r *Request) writeSecureJSON(code int, data any) {
+	r.write(code, MIMEJSON, func(w io.Writer) error {
+		if _, err := io.WriteString(w, r.router.jsonConfig.SecurePrefix); err != nil {
+			return err
+		}
+		return r.router.encodeJSON(w, data, r.router.jsonConfig.EscapeHTML, "", r.jsonIndent())
+	})
 }
 
-func (r *Request) writeHTMLTemplate(code int, name string, templ template.Template, data any) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *Request) writeJSONP(code int, callback string, data any) {
+	r.write(code, MIMEJavaScript, func(w io.Writer) error {
+		// the comment prevents the Rosetta Flash attack
+		if _, err := io.WriteString(w, "/**/"+callback+"("); err != nil {
+			return err
+		}
+		if err := r.router.encodeJSON(w, data, r.router.jsonConfig.EscapeHTML, "", r.jsonIndent()); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, ");")
+		return err
+	})
+}
 
-	r.Writer.Header().Set("Content-Type", "text/html")
+func (r *Request) writeXML(code int, data any) {
+	r.writeRendered(code, MIMEXML, data)
+}
 
-	r.SetStatus(code)
-	err := templ.ExecuteTemplate(r.Writer, name, data)
-	if err != nil {
-		log.error(fmt.Sprint("failed to execute HTML template: %w", err), r.handlerName)
-		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
-		return
-	}
+func (r *Request) writeXMLIndent(code int, data any, prefix, indent string) {
+	r.write(code, MIMEXML, func(w io.Writer) error {
+		encoder := xml.NewEncoder(w)
+		encoder.Indent(prefix, indent)
+		return encoder.Encode(data)
+	})
+}
+
+func (r *Request) writeHTML(code int, templ *template.Template, data any) {
+	r.write(code, MIMEHTML, func(w io.Writer) error {
+		return templ.Execute(w, data)
+	})
+}
+
+func (r *Request) writeHTMLTemplate(code int, name string, templ *template.Template, data any) {
+	r.write(code, MIMEHTML, func(w io.Writer) error {
+		return templ.ExecuteTemplate(w, name, data)
+	})
 }
 
 func (r *Request) writeBINARY(code int, data []byte) {
+	r.write(code, "", func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+func (r *Request) writeFILE(code int, name, disposition, displayName string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.SetStatus(code)
-	_, err := r.Writer.Write(data)
+	file, err := os.Open(name)
 	if err != nil {
-		log.error(err.Error(), r.handlerName)
+		r.logError("failed to open file", "file", name, "error", err)
+		if errors.Is(err, fs.ErrNotExist) {
+			r.abortWithErr(http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+			return
+		}
 		r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
 		return
 	}
-}
-
-func (req *Request) writeFILE(code int, name string) {
-	req.mu.Lock()
-	defer req.mu.Unlock()
-
-	req.Writer.Header().Set(
-		"Content-Disposition",
-		fmt.Sprintf("attachment; filename=%s", name),
-	)
+	defer file.Close()
 
-	req.Writer.Header().Set(
-		"Content-Type",
-		req.Req.Header.Get("Content-Type"),
-	)
-
-	fileBytes, err := os.ReadFile(name)
-	if err != nil {
-		log.error(
-			fmt.Sprintf("failed to read file: %s | error: %s", name, err.Error()),
-			req.handlerName,
-		)
-		req.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		r.logError("file is not a regular file", "file", name)
+		r.abortWithErr(http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+		return
 	}
 
-	_, err = io.Copy(req.Writer, bytes.NewReader(fileBytes))
-	if err != nil {
-		log.error(
-			fmt.Sprintf("failed to copy file: %s | error: %s", name, err.Error()),
-			req.handlerName,
-		)
-		req.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
+	if disposition != "" {
+		if displayName == "" {
+			displayName = info.Name()
+		}
+		r.Writer.Header().Set("Content-Disposition", contentDisposition(disposition, displayName))
 	}
+	r.serveContent(code, info.Name(), info.ModTime(), info.Size(), file)
 }
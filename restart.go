@@ -0,0 +1,234 @@
+package rapidroot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// listenFDsEnv is the number of listeners passed to the new process on
+	// restart, starting from descriptor 3 in the order of the parent listeners.
+	listenFDsEnv = "RAPIDROOT_LISTEN_FDS"
+	// readyFDEnv is the descriptor of the pipe, the new process writes to it
+	// when it serves the listeners.
+	readyFDEnv = "RAPIDROOT_READY_FD"
+
+	inheritedFDsStart     = 3
+	defaultRestartTimeout = 30 * time.Second
+)
+
+// inherited holds the listeners passed by the parent process on restart.
+var inherited struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners []net.Listener
+}
+
+func loadInheritedListeners() {
+	count, err := strconv.Atoi(os.Getenv(listenFDsEnv))
+	os.Unsetenv(listenFDsEnv)
+	if err != nil || count <= 0 {
+		return
+	}
+	for i := 0; i < count; i++ {
+		file := os.NewFile(uintptr(inheritedFDsStart+i), "inherited listener")
+		// FileListener duplicates the descriptor with close-on-exec set
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			continue
+		}
+		// the parent leaves the socket file to this process, which removes it on shutdown
+		if unixListener, ok := listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(true)
+		}
+		inherited.listeners = append(inherited.listeners, listener)
+	}
+}
+
+// inheritedListener returns the next listener passed by the parent process, or
+// nil if there are no more. Listeners are returned in the order they were
+// served by the parent, which runs the same code.
+func inheritedListener() net.Listener {
+	inherited.once.Do(loadInheritedListeners)
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	if len(inherited.listeners) == 0 {
+		return nil
+	}
+	listener := inherited.listeners[0]
+	inherited.listeners = inherited.listeners[1:]
+	return listener
+}
+
+// inheritedListeners returns all remaining listeners passed by the parent process.
+func inheritedListeners() []net.Listener {
+	inherited.once.Do(loadInheritedListeners)
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	listeners := inherited.listeners
+	inherited.listeners = nil
+	return listeners
+}
+
+// listen returns the listener passed by the parent process on restart,
+// otherwise it listens on the address.
+func listen(network, addr string) (net.Listener, error) {
+	if listener := inheritedListener(); listener != nil {
+		return listener, nil
+	}
+	return net.Listen(network, addr)
+}
+
+// notifyParentReady tells the parent process that the restarted server is ready.
+func notifyParentReady() error {
+	fd, err := strconv.Atoi(os.Getenv(readyFDEnv))
+	if err != nil {
+		return nil
+	}
+	os.Unsetenv(readyFDEnv)
+	file := os.NewFile(uintptr(fd), "ready")
+	defer file.Close()
+	_, err = file.Write([]byte{1})
+	return err
+}
+
+// Restart upgrades the running server without dropping connections: it starts
+// the executable of the process again with the same arguments, passes it the
+// listeners of the server, waits until the new process serves them and shuts
+// down gracefully. The listeners are picked up by Run, RunContext, RunWithTLS,
+// RunUnix and RunSystemd of the new process. If the new process fails to
+// start, the server keeps running and the error is returned.
+//
+// Example:
+//
+//	// replace the binary, then `kill -HUP <pid>`
+//	router.SetShutdownConfig(rr.ShutdownConfig{HandleSignals: true, HandleRestart: true})
+//	err := router.Run(":8080")
+func (r *Router) Restart() error {
+	if !r.restarting.CompareAndSwap(false, true) {
+		return errors.New("the server is already restarting")
+	}
+	defer r.restarting.Store(false)
+
+	r.serverMu.Lock()
+	listeners := r.listeners
+	r.serverMu.Unlock()
+	if len(listeners) == 0 {
+		return errors.New("the server isn't running")
+	}
+
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, listener := range listeners {
+		filer, ok := listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener %s can't be passed to the new process", listener.Addr())
+		}
+		file, err := filer.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+	files = append(files, readyWriter)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		listenFDsEnv+"="+strconv.Itoa(len(listeners)),
+		readyFDEnv+"="+strconv.Itoa(inheritedFDsStart+len(listeners)),
+	)
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the new process: %w", err)
+	}
+	// the pipe is closed when the new process exits without notifying
+	readyWriter.Close()
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyReader.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	timeout := r.shutdownConfig.RestartTimeout
+	if timeout <= 0 {
+		timeout = defaultRestartTimeout
+	}
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return fmt.Errorf("the new process exited before it was ready: %w", err)
+		}
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return errors.New("the new process wasn't ready before the restart timeout")
+	}
+	go cmd.Wait()
+
+	for _, listener := range listeners {
+		// the socket file is used by the new process
+		if unixListener, ok := listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(false)
+		}
+	}
+	r.log().Info("the new process is ready, shutting down", "pid", cmd.Process.Pid)
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.drainTimeout())
+	defer cancel()
+	return r.Shutdown(ctx)
+}
+
+// restartOnSignal restarts the server on SIGHUP until the shutdown, the returned
+// function stops it.
+func (r *Router) restartOnSignal() (stop func()) {
+	hangup := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hangup:
+				r.log().Info("restarting the server")
+				if err := r.Restart(); err != nil {
+					r.log().Error("failed to restart the server", "error", err)
+				}
+			case <-r.done:
+				return
+			case <-stopped:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hangup)
+		close(stopped)
+	}
+}
@@ -0,0 +1,58 @@
+//go:build linux
+
+package rapidroot
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestInheritedUnixListener runs the test binary as the new process of a
+// restart, which removes the inherited socket file when it closes the listener.
+func TestInheritedUnixListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like the parent on restart, which leaves the socket file to the new process
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	defer listener.Close()
+	file, err := listener.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInheritedUnixListenerProcess$")
+	cmd.Env = append(os.Environ(), "RAPIDROOT_TEST_RESTART=1", listenFDsEnv+"=1", "TEST_UNIX_ADDR="+path)
+	cmd.ExtraFiles = []*os.File{file}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("restarted process failed: %v\n%s", err, out)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("socket file wasn't removed by the new process: %v", err)
+	}
+}
+
+func TestInheritedUnixListenerProcess(t *testing.T) {
+	if os.Getenv("RAPIDROOT_TEST_RESTART") != "1" {
+		t.Skip("run by TestInheritedUnixListener")
+	}
+	listener := inheritedListener()
+	if listener == nil {
+		t.Fatal("no inherited listener")
+	}
+	if got := listener.Addr().String(); got != os.Getenv("TEST_UNIX_ADDR") {
+		t.Fatalf("inherited listener = %s", got)
+	}
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
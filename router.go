@@ -2,20 +2,97 @@ package rapidroot
 
 import (
 	"fmt"
+	"io/fs"
+	"net"
 	"net/http"
+	"net/netip"
+	"sync"
+	"sync/atomic"
 )
 
 type Router struct {
 	tree       map[string]*node
 	routesList []byte
+
+	// renderers registered by media type, rendererOrder keeps the registration
+	// order which is used as a preference in content negotiation.
+	renderers     map[string]Renderer
+	rendererOrder []string
+
+	wsConfig   WebSocketConfig
+	jsonConfig JSONConfig
+	bodyLimit  int64
+
+	// logger of the router, if it's nil the default logger is used
+	logger Logger
+
+	// accessLog replaces the request log of the logger if it's set
+	accessLog *accessLogger
+
+	// trustedProxies are the proxies whose forwarded headers are used by Request.ClientIP
+	trustedProxies []netip.Prefix
+
+	// templates parsed by LoadTemplatesFS, nil if templates aren't loaded.
+	// templateFS and templateConfig are kept to re-parse them in the dev mode,
+	// they are guarded by templateMu, since the watcher reads them.
+	// templateErr holds the error of the last failed reload.
+	templates          atomic.Pointer[templateSet]
+	templateErr        atomic.Pointer[error]
+	templateMu         sync.RWMutex
+	templateFS         fs.FS
+	templateConfig     TemplateConfig
+	watchTemplatesOnce sync.Once
+
+	devMode   bool
+	devConfig DevConfig
+	// builtRoutes is the route table printed by Build, the dev mode prints it
+	// after each templates reload
+	builtRoutes atomic.Pointer[string]
+
+	// notFound handles requests without matching route, if it's nil notFoundHandler is used
+	notFound HandlerFunc
+
+	// errs are the errors of the route registration, reported by Build
+	errs []error
+	// built is set by Build, after the middleware is applied to the routes
+	built bool
+
+	// server started by RunContext, it's shut down by Shutdown
+	serverConfig   ServerConfig
+	server         *http.Server
+	listeners      []net.Listener
+	redirectServer *http.Server
+	httpsConfig    HTTPSConfig
+	hstsHeader     string
+	restarting     atomic.Bool
+	serverMu       sync.Mutex
+	shutdownConfig ShutdownConfig
+	beforeShutdown []ShutdownHook
+	afterShutdown  []ShutdownHook
+	shutdownOnce   sync.Once
+	shutdownDone   chan struct{}
+	shutdownErr    error
+
+	// done is closed when the shutdown starts, it stops background goroutines of the router
+	done chan struct{}
 }
 
 // NewRouter returns a new router instance with default configuration.
 func NewRouter() *Router {
-	return &Router{
-		tree:       make(map[string]*node),
-		routesList: []byte("\n------------Handlers--------------\n\n"),
+	r := &Router{
+		tree:         make(map[string]*node),
+		routesList:   []byte("\n------------Handlers--------------\n\n"),
+		renderers:    make(map[string]Renderer),
+		jsonConfig:   DefaultJSONConfig(),
+		serverConfig: DefaultServerConfig(),
+		shutdownConfig: ShutdownConfig{
+			DrainTimeout: defaultDrainTimeout,
+		},
+		shutdownDone: make(chan struct{}),
+		done:         make(chan struct{}),
 	}
+	r.registerDefaultRenderers()
+	return r
 }
 
 // Helper method to get or create the root node for a specific HTTP method.
@@ -31,29 +108,19 @@ func (r *Router) getOrCreateRoot(method string) *node {
 func (r *Router) handle(method, path string, handler HandlerFunc) {
 	r.routesList = append(r.routesList, []byte(fmt.Sprintf("%s %s %s\n", method, path, getFunctionName(handler)))...)
 	if handler == nil {
-		log.fatal(fmt.Errorf("nil handlers are not allowed | %s %s %s\n", method, path, "nil"))
+		r.errs = append(r.errs, fmt.Errorf("nil handlers are not allowed | %s %s", method, path))
+		return
 	}
 
 	path = cleanPath(path)
-	root := r.getOrCreateRoot(method)
-
 	if path == "/" {
-		if root.pathSegment != "/" {
-			newRoot := newNode()
-			newRoot.pathSegment = "/"
-			newRoot.children = append(newRoot.children, root)
-			r.tree[method] = newRoot
-		} else {
-			root.handler = handler
-		}
-		return
-	}
-
-	node := getNode(path, root, nil)
-	if node == nil {
-		node = addRoute(path, root, handler)
+		// an empty path is the root route, which is stored like "/" without
+		// the trailing slash
+		path = ""
 	}
-	node.handler = handler
+	root := r.getOrCreateRoot(method)
+	// the node of the same route is reused, other routes matching the path get their own
+	addRoute(path, root, handler)
 }
 
 func (r *Router) getHandler(method, path string, req *Request) HandlerFunc {
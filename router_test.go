@@ -0,0 +1,126 @@
+package rapidroot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// routeHandler responds with the name of the route and the value of param.
+func routeHandler(name, param string) HandlerFunc {
+	return func(req *Request) {
+		value, _ := req.Value(param).(string)
+		req.BINARY(http.StatusOK, []byte(name+" "+value))
+	}
+}
+
+func serveRoute(router *Router, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestRouteLookup(t *testing.T) {
+	router := NewRouter()
+	router.GET("/users/$id", routeHandler("user", "id"))
+	router.GET("/users/me", routeHandler("me", "id"))
+	router.GET("/users/new/edit", routeHandler("edit", "id"))
+	router.GET("/users/$id/posts/$post", routeHandler("post", "post"))
+	router.GET("/files/*path", routeHandler("file", "path"))
+	router.GET("/files/docs/readme", routeHandler("readme", "path"))
+	if err := router.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/users/42", http.StatusOK, "user 42"},
+		{"/users/me", http.StatusOK, "me "},
+		// the static sibling only matches deeper paths, so the dynamic route is used
+		{"/users/new", http.StatusOK, "user new"},
+		{"/users/new/edit", http.StatusOK, "edit "},
+		{"/users/new/posts/7", http.StatusOK, "post 7"},
+		{"/users/42/posts", http.StatusNotFound, ""},
+		{"/files/docs/readme", http.StatusOK, "readme "},
+		{"/files/docs/other", http.StatusOK, "file docs/other"},
+		{"/files/a/b/c", http.StatusOK, "file a/b/c"},
+		{"/unknown", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		rec := serveRoute(router, http.MethodGet, test.target)
+		if rec.Code != test.code {
+			t.Errorf("GET %s = %d, want %d", test.target, rec.Code, test.code)
+			continue
+		}
+		if test.code == http.StatusOK && rec.Body.String() != test.body {
+			t.Errorf("GET %s = %q, want %q", test.target, rec.Body.String(), test.body)
+		}
+	}
+}
+
+func TestMiddlewareOfDynamicRoute(t *testing.T) {
+	router := NewRouter()
+	router.GET("/users/$id", routeHandler("user", "id"))
+	router.GET("/users/me", routeHandler("me", "id"))
+	router.Middleware(http.MethodGet, "/users/$id", func(next HandlerFunc) HandlerFunc {
+		return func(req *Request) {
+			req.Writer.Header().Set("X-Middleware", "user")
+			next(req)
+		}
+	})
+	if err := router.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := serveRoute(router, http.MethodGet, "/users/42"); rec.Header().Get("X-Middleware") != "user" {
+		t.Fatalf("middleware of the dynamic route wasn't applied: %v", rec.Header())
+	}
+	if rec := serveRoute(router, http.MethodGet, "/users/me"); rec.Header().Get("X-Middleware") != "" {
+		t.Fatalf("middleware of the dynamic route was applied to the static one")
+	}
+}
+
+// TestStaticNextToRoute mounts a static prefix next to an explicit route
+// under it, the files must still be served.
+func TestStaticNextToRoute(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "index.html"), []byte("index"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	router := NewRouter()
+	router.Static("/assets", dir)
+	router.GET("/assets/sub/special", routeHandler("special", ""))
+	if err := router.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/assets/sub", http.StatusMovedPermanently, ""},
+		{"/assets/sub/", http.StatusOK, "index"},
+		{"/assets/sub/index.html", http.StatusOK, "index"},
+		{"/assets/sub/special", http.StatusOK, "special "},
+	}
+	for _, test := range tests {
+		rec := serveRoute(router, http.MethodGet, test.target)
+		if rec.Code != test.code {
+			t.Errorf("GET %s = %d, want %d", test.target, rec.Code, test.code)
+			continue
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("GET %s = %q, want %q", test.target, rec.Body.String(), test.body)
+		}
+	}
+}
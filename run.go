@@ -1,78 +1,155 @@
 package rapidroot
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"time"
 )
 
-type responseCodeWrapper struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (w *responseCodeWrapper) WriteHeader(statusCode int) {
-	if w.statusCode != 0 {
-		log.warn("Couldn't change status of the response, it had already been changed")
-		return
-	}
-	w.statusCode = statusCode
-	w.ResponseWriter.WriteHeader(statusCode)
-}
-
-func (w *responseCodeWrapper) Write(data []byte) (int, error) {
-	if w.statusCode == 0 {
-		w.statusCode = http.StatusOK
-	}
-	return w.ResponseWriter.Write(data)
-}
-
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	resp := &responseCodeWrapper{w, 0}
-	reqStruct := getRequest(resp, req)
+	start := time.Now()
+	resp := newResponseCodeWrapper(w, r.log())
+	r.setHSTS(resp, req)
+	reqStruct := getRequest(r, resp, req)
 	defer releaseRequest(reqStruct)
+	// deferred to log requests that panicked too
+	defer func() {
+		rec := recover()
+		r.logServed(reqStruct, start, rec != nil)
+		if rec != nil {
+			panic(rec)
+		}
+	}()
 
 	handler := r.getHandler(req.Method, cleanPath(req.URL.Path), reqStruct)
 	if handler == nil {
-		notFoundHandler(w, req)
-		return
+		handler = r.notFound
+		if handler == nil {
+			handler = notFoundHandler
+		}
 	}
 	reqStruct.handlerName = getFunctionName(handler)
+	reqStruct.limitBody(r.bodyLimit)
 	handlerWrapper(handler, reqStruct)
-	log.logRequest(req.URL.Path, req.Method, resp.statusCode)
+}
+
+// logServed writes the access log if it's set, otherwise the request log.
+func (r *Router) logServed(req *Request, start time.Time, panicked bool) {
+	if r.accessLog != nil {
+		r.accessLog.log(req.accessLogEntry(start, panicked))
+		return
+	}
+	r.logRequest(req.Req, req.servedStatus(panicked), time.Since(start), req.handlerName)
 }
 
 func handlerWrapper(handler HandlerFunc, req *Request) {
+	if req.router.devMode {
+		defer req.recoverDevPanic()
+	}
 	handler(req)
-	if req.Writer.(*responseCodeWrapper).statusCode == 0 {
+	if req.GetStatus() == 0 {
 		req.SetStatus(http.StatusOK)
 	}
 }
 
-// Run starts the HTTP server.
-func (r *Router) Run(addr string) {
-	r.addRoutesListSeparator()
-	r.applyMiddlewareForRoutes()
-	if err := http.ListenAndServe(addr, r); err != nil {
-		log.fatal(fmt.Errorf("Couldn't start the server: %w", err))
+// Build applies the middleware to the routes and returns the errors of the
+// route registration. It's called by Run and RunWithTLS, routers used as
+// http.Handler by other servers must be built before serving.
+// Build is only applied once, routes registered later are ignored by it.
+func (r *Router) Build() error {
+	if !r.built {
+		r.built = true
+		r.addRoutesListSeparator()
+		r.applyMiddlewareForRoutes()
 	}
+	return errors.Join(r.errs...)
+}
+
+// Run builds the router and starts the HTTP server, see RunContext.
+// It returns the error of the route registration or the server.
+func (r *Router) Run(addr string) error {
+	return r.RunContext(context.Background(), addr)
+}
+
+// MustRun is like Run, but it logs the error and exits the process.
+func (r *Router) MustRun(addr string) {
+	r.exitOnError(r.Run(addr))
 }
 
 // addRoutesListSeparator adds a separator to the routes list for debugging purposes.
 func (r *Router) addRoutesListSeparator() {
-	if log.output != os.Stdout {
-		return
-	}
 	r.routesList = append(r.routesList, []byte("\n----------------------------------\n\n")...)
-	logHandlers(string(r.routesList))
+	routes := string(r.routesList)
+	r.logRoutes(routes)
+	// the template watcher of the dev mode runs concurrently with the route
+	// registration, so it gets a snapshot of the table
+	r.builtRoutes.Store(&routes)
 	r.routesList = nil
 }
 
-// RunWithTLS starts the HTTPS server.
-func (r *Router) RunWithTLS(addr, certFile, keyFile string) {
-	r.applyMiddlewareForRoutes()
-	err := http.ListenAndServeTLS(addr, certFile, keyFile, r)
+// RunWithTLS builds the router and starts the HTTPS server with DefaultTLSConfig,
+// which is shut down like the server of RunContext. The certificate is
+// reloaded when its files change, see CertReloader.
+// It returns the error of the route registration or the server.
+func (r *Router) RunWithTLS(addr, certFile, keyFile string) error {
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("Couldn't start the server: %w", err)
+	}
+	reloader.logger = r.log()
+
+	config := DefaultTLSConfig()
+	config.GetCertificate = reloader.GetCertificate
+	return r.RunWithTLSConfig(addr, config)
+}
+
+// RunWithTLSConfig builds the router and starts the HTTPS server with the TLS
+// config, which is shut down like the server of RunContext. Start from
+// DefaultTLSConfig for modern defaults.
+// It returns the error of the route registration or the server.
+//
+// Example of a server, which requires client certificates:
+//
+//	config := rr.DefaultTLSConfig()
+//	config.Certificates = []tls.Certificate{cert}
+//	config.ClientAuth = tls.RequireAndVerifyClientCert
+//	config.ClientCAs, err = rr.LoadCertPool("clients-ca.pem")
+//	// handle err
+//	err = router.RunWithTLSConfig(":443", config)
+func (r *Router) RunWithTLSConfig(addr string, config *tls.Config) error {
+	if err := r.Build(); err != nil {
+		return err
+	}
+	if config == nil {
+		return errors.New("Couldn't start the server: nil TLS config")
+	}
+	config = config.Clone()
+	if addr == "" {
+		addr = ":https"
+	}
+	listener, err := listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Couldn't start the server: %w", err)
+	}
+	return r.serve(context.Background(), []net.Listener{listener}, func(server *http.Server, listener net.Listener) error {
+		server.TLSConfig = config
+		return server.ServeTLS(listener, "", "")
+	})
+}
+
+// MustRunWithTLS is like RunWithTLS, but it logs the error and exits the process.
+func (r *Router) MustRunWithTLS(addr, certFile, keyFile string) {
+	r.exitOnError(r.RunWithTLS(addr, certFile, keyFile))
+}
+
+func (r *Router) exitOnError(err error) {
 	if err != nil {
-		log.fatal(fmt.Errorf("Couldn't start the server, err: %w", err))
+		r.log().Error(err.Error())
+		os.Exit(1)
 	}
 }
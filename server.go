@@ -0,0 +1,404 @@
+package rapidroot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultDrainTimeout is the time given to in-flight requests on shutdown.
+const defaultDrainTimeout = 30 * time.Second
+
+// ServerConfig configures the http.Server started by the router, see http.Server
+// for the meaning of the fields. Start from DefaultServerConfig, since zero
+// timeouts mean no timeouts.
+type ServerConfig struct {
+	// ReadHeaderTimeout protects against slow clients, like slowloris attacks.
+	ReadHeaderTimeout time.Duration
+
+	// ReadTimeout limits reading of the whole request. Big uploads can replace
+	// it for each part with UploadLimits.ReadTimeout of Request.MultipartReader.
+	ReadTimeout time.Duration
+
+	// WriteTimeout limits writing of the response. Files sent by Request.FILE
+	// and Static extend it while the client keeps reading, so it limits the
+	// time without progress for them. Streams of Request.SSE, Request.NDJSON
+	// and Request.StreamJSONArray clear it, other long responses can do it
+	// with http.ResponseController.
+	WriteTimeout time.Duration
+
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+
+	// ErrorLog logs errors of the connections, it defaults to the logger of
+	// the router on warn level.
+	ErrorLog *log.Logger
+
+	ConnState   func(net.Conn, http.ConnState)
+	BaseContext func(net.Listener) context.Context
+
+	// Protocols are the protocols served by the server, nil means HTTP/1 and
+	// HTTP/2 over TLS.
+	Protocols *http.Protocols
+
+	// H2C adds unencrypted HTTP/2 to Protocols, for clients with prior
+	// knowledge like proxies of service meshes, which terminate TLS, and
+	// upgrades HTTP/1.1 requests with "Upgrade: h2c". Requests with a body
+	// are served over HTTP/1.1 without the upgrade, which RFC 7540 allows.
+	H2C bool
+}
+
+// DefaultServerConfig returns the server configuration used by NewRouter.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+	}
+}
+
+// SetServerConfig sets the configuration of the servers started by the router.
+//
+// Example:
+//
+//	config := rr.DefaultServerConfig()
+//	config.WriteTimeout = 5 * time.Minute
+//	config.H2C = true
+//	router.SetServerConfig(config)
+func (r *Router) SetServerConfig(config ServerConfig) {
+	r.serverConfig = config
+}
+
+// ownServer returns the server of the router, if it serves the request.
+// Servers that embed the router as a handler keep their own deadlines.
+func (r *Router) ownServer(req *http.Request) *http.Server {
+	server, _ := req.Context().Value(http.ServerContextKey).(*http.Server)
+	if server == nil {
+		return nil
+	}
+	r.serverMu.Lock()
+	defer r.serverMu.Unlock()
+	if server != r.server {
+		return nil
+	}
+	return server
+}
+
+// newServer returns the server of the router configured by ServerConfig.
+func (r *Router) newServer(addr string) *http.Server {
+	config := r.serverConfig
+	errorLog := config.ErrorLog
+	if errorLog == nil {
+		errorLog = log.New(logWriter{router: r}, "", 0)
+	}
+	var protocols *http.Protocols
+	if config.Protocols != nil || config.H2C {
+		protocols = new(http.Protocols)
+		if config.Protocols != nil {
+			*protocols = *config.Protocols
+		} else {
+			protocols.SetHTTP1(true)
+			protocols.SetHTTP2(true)
+		}
+		if config.H2C {
+			protocols.SetUnencryptedHTTP2(true)
+		}
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           r,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+		ErrorLog:          errorLog,
+		ConnState:         config.ConnState,
+		BaseContext:       config.BaseContext,
+		Protocols:         protocols,
+	}
+	if config.H2C {
+		server.Handler = newH2CUpgradeHandler(r, server)
+	}
+	return server
+}
+
+// logWriter writes the lines of the server error log to the router logger.
+type logWriter struct {
+	router *Router
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.router.log().Warn(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+// ShutdownHook is called on shutdown of the server, see Router.BeforeShutdown
+// and Router.AfterShutdown.
+type ShutdownHook func(ctx context.Context) error
+
+// ShutdownConfig configures the graceful shutdown of the server.
+type ShutdownConfig struct {
+	// HandleSignals shuts down the server on SIGINT and SIGTERM.
+	HandleSignals bool
+
+	// DrainTimeout is the maximum time to wait for in-flight requests after
+	// a signal or cancellation of the context of Router.RunContext, after it
+	// the remaining connections are closed. Defaults to 30 seconds.
+	// Hijacked connections, like WebSockets, aren't waited for.
+	DrainTimeout time.Duration
+
+	// ReadinessDelay is the time between the hooks of Router.BeforeShutdown and
+	// closing the listeners, so load balancers notice that the server isn't
+	// ready before it stops accepting connections.
+	ReadinessDelay time.Duration
+
+	// HandleRestart restarts the server on SIGHUP, see Router.Restart.
+	HandleRestart bool
+
+	// RestartTimeout is the maximum time to wait for the new process to be
+	// ready on restart. Defaults to 30 seconds.
+	RestartTimeout time.Duration
+}
+
+// SetShutdownConfig sets the shutdown configuration of the router.
+//
+// Example:
+//
+//	router.SetShutdownConfig(rr.ShutdownConfig{
+//		HandleSignals:  true,
+//		DrainTimeout:   20 * time.Second,
+//		ReadinessDelay: 5 * time.Second,
+//	})
+func (r *Router) SetShutdownConfig(config ShutdownConfig) {
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = defaultDrainTimeout
+	}
+	r.shutdownConfig = config
+}
+
+// BeforeShutdown adds a hook which is called when the shutdown starts, before
+// the server stops accepting connections, e.g. to fail readiness checks.
+func (r *Router) BeforeShutdown(hook ShutdownHook) {
+	r.beforeShutdown = append(r.beforeShutdown, hook)
+}
+
+// AfterShutdown adds a hook which is called after all requests are finished,
+// e.g. to close database pools. Hooks are called in reverse order of adding.
+// They are called when the server fails too, and if the drain used up the
+// context of the shutdown, they get a new one limited by DrainTimeout.
+func (r *Router) AfterShutdown(hook ShutdownHook) {
+	r.afterShutdown = append(r.afterShutdown, hook)
+}
+
+// RunContext builds the router and starts the HTTP server, which is shut down
+// gracefully when ctx is canceled, or on SIGINT and SIGTERM if
+// ShutdownConfig.HandleSignals is set. It returns nil after a graceful shutdown.
+//
+// Example:
+//
+//	router.SetShutdownConfig(rr.ShutdownConfig{HandleSignals: true})
+//	router.BeforeShutdown(func(ctx context.Context) error {
+//		ready.Store(false)
+//		return nil
+//	})
+//	router.AfterShutdown(func(ctx context.Context) error {
+//		return db.Close()
+//	})
+//	if err := router.RunContext(context.Background(), ":8080"); err != nil {
+//		log.Fatal(err)
+//	}
+func (r *Router) RunContext(ctx context.Context, addr string) error {
+	if err := r.Build(); err != nil {
+		return err
+	}
+	if addr == "" {
+		addr = ":http"
+	}
+	listener, err := listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Couldn't start the server: %w", err)
+	}
+	return r.serve(ctx, []net.Listener{listener}, (*http.Server).Serve)
+}
+
+// Serve builds the router and serves the connections of the listener, which
+// is closed when the server is shut down like the server of RunContext.
+//
+// Example:
+//
+//	listener, err := net.Listen("tcp", ":8080")
+//	// handle err
+//	err = router.Serve(listener)
+func (r *Router) Serve(listener net.Listener) error {
+	return r.ServeListeners(listener)
+}
+
+// ServeListeners is like Serve, but serves the connections of all listeners
+// with a single server.
+func (r *Router) ServeListeners(listeners ...net.Listener) error {
+	if len(listeners) == 0 {
+		return errors.New("no listeners to serve")
+	}
+	if err := r.Build(); err != nil {
+		return err
+	}
+	return r.serve(context.Background(), listeners, (*http.Server).Serve)
+}
+
+// serve serves the listeners with serveListener until ctx is canceled or the
+// router is shut down.
+func (r *Router) serve(ctx context.Context, listeners []net.Listener, serveListener func(*http.Server, net.Listener) error) error {
+	server := r.newServer(listeners[0].Addr().String())
+	r.serverMu.Lock()
+	if r.server != nil {
+		r.serverMu.Unlock()
+		return errors.New("the server is already running")
+	}
+	r.server = server
+	r.listeners = listeners
+	r.serverMu.Unlock()
+
+	if r.shutdownConfig.HandleSignals {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+	if r.shutdownConfig.HandleRestart {
+		stop := r.restartOnSignal()
+		defer stop()
+	}
+
+	serveErr := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			err := serveListener(server, listener)
+			// the error is sent before the server is closed, so it's received
+			// before http.ErrServerClosed of the other listeners
+			serveErr <- err
+			if !errors.Is(err, http.ErrServerClosed) {
+				// don't keep serving the other listeners, ServeTLS doesn't
+				// close the listener if the certificate can't be loaded
+				listener.Close()
+				server.Close()
+			}
+		}(listener)
+	}
+	if err := notifyParentReady(); err != nil {
+		r.log().Error("failed to notify the parent process", "error", err)
+	}
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			r.serverMu.Lock()
+			r.server, r.listeners = nil, nil
+			r.serverMu.Unlock()
+			// the hooks clean up after the failed server too
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), r.drainTimeout())
+			defer cancel()
+			return errors.Join(fmt.Errorf("Couldn't start the server: %w", err), r.Shutdown(shutdownCtx))
+		}
+		// Shutdown was called, the server must not exit before it's finished
+		<-r.shutdownDone
+		return r.shutdownErr
+	case <-ctx.Done():
+		r.log().Info("shutting down the server", "timeout", r.drainTimeout())
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), r.drainTimeout())
+		defer cancel()
+		return r.Shutdown(shutdownCtx)
+	}
+}
+
+// drainTimeout returns the timeout of the whole shutdown, including the readiness delay.
+func (r *Router) drainTimeout() time.Duration {
+	timeout := r.shutdownConfig.DrainTimeout
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+	return timeout + r.shutdownConfig.ReadinessDelay
+}
+
+// hookTimeout returns the timeout of the AfterShutdown hooks, if the drain used
+// up the context of the shutdown.
+func (r *Router) hookTimeout() time.Duration {
+	if timeout := r.shutdownConfig.DrainTimeout; timeout > 0 {
+		return timeout
+	}
+	return defaultDrainTimeout
+}
+
+// Shutdown gracefully shuts down the server started by the router: it calls
+// the BeforeShutdown hooks, stops accepting connections, waits for in-flight
+// requests until ctx is done, closes the remaining connections and calls the
+// AfterShutdown hooks. Subsequent calls return the result of the first one.
+func (r *Router) Shutdown(ctx context.Context) error {
+	r.shutdownOnce.Do(func() {
+		defer close(r.shutdownDone)
+		r.shutdownErr = r.shutdown(ctx)
+	})
+	<-r.shutdownDone
+	return r.shutdownErr
+}
+
+func (r *Router) shutdown(ctx context.Context) error {
+	close(r.done)
+
+	var errs []error
+	for _, hook := range r.beforeShutdown {
+		if err := hook(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	r.serverMu.Lock()
+	server, redirectServer := r.server, r.redirectServer
+	r.serverMu.Unlock()
+
+	if delay := r.shutdownConfig.ReadinessDelay; delay > 0 && (server != nil || redirectServer != nil) {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	if redirectServer != nil {
+		if err := redirectServer.Shutdown(ctx); err != nil {
+			r.log().Warn("redirect requests weren't finished before the drain timeout", "error", err)
+			redirectServer.Close()
+			errs = append(errs, err)
+		}
+	}
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			r.log().Warn("requests weren't finished before the drain timeout", "error", err)
+			server.Close()
+			errs = append(errs, err)
+		}
+	}
+
+	// the drain may have used up ctx, the hooks still need time to clean up
+	hookCtx := ctx
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		hookCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), r.hookTimeout())
+		defer cancel()
+	}
+	for i := len(r.afterShutdown) - 1; i >= 0; i-- {
+		if err := r.afterShutdown[i](hookCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,53 @@
+package rapidroot
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServeListenersFailure serves a closed listener next to an open one, the
+// error of the closed one must be returned instead of waiting for Shutdown.
+func TestServeListenersFailure(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		closed, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		closed.Close()
+		open, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- NewRouter().ServeListeners(closed, open) }()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Fatal("ServeListeners returned no error")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("ServeListeners didn't return after a listener failed")
+		}
+	}
+}
+
+// TestRunRedirectToHTTPSRetry checks that the redirect server can be started
+// again after it failed to listen.
+func TestRunRedirectToHTTPSRetry(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	router := NewRouter()
+	for i := 0; i < 2; i++ {
+		err := router.RunRedirectToHTTPS(listener.Addr().String())
+		if err == nil || !strings.Contains(err.Error(), "Couldn't start the redirect server") {
+			t.Fatalf("RunRedirectToHTTPS returned %v, want the listen error", err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package rapidroot
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// SPAConfig configures single page application serving, see Router.SPA.
+type SPAConfig struct {
+	// Index is the application shell served for client side routes.
+	// Defaults to "index.html".
+	Index string
+
+	// Exclude contains path prefixes, e.g. "/api", which always get a real 404
+	// for unmatched requests.
+	Exclude []string
+
+	// MaxAge sets the Cache-Control max-age of the assets. The shell is
+	// always served with "no-cache", so new deployments are picked up.
+	MaxAge time.Duration
+}
+
+// SPA serves a single page application from the directory dir on disk, see SPAFS.
+func (r *Router) SPA(dir string, config SPAConfig) {
+	r.SPAFS(os.DirFS(dir), config)
+}
+
+// SPAFS serves a single page application from fsys for requests that don't
+// match any route. Existing files are served as assets, HTML navigations to
+// any other path get the index file, so the client side router can handle them.
+// Missing assets, non-GET requests, requests that don't accept HTML and
+// requests under excluded prefixes get 404.
+//
+// Example:
+//
+//	router.GET("/api/users", usersHandler)
+//	router.SPAFS(dist, rr.SPAConfig{Exclude: []string{"/api"}})
+//	// GET /settings/profile with "Accept: text/html" serves index.html
+//	// GET /api/unknown gets 404
+func (r *Router) SPAFS(fsys fs.FS, config SPAConfig) {
+	if config.Index == "" {
+		config.Index = "index.html"
+	}
+	assets := StaticConfig{Precompressed: true, MaxAge: config.MaxAge}
+	shell := StaticConfig{Precompressed: true}
+
+	r.notFound = func(req *Request) {
+		urlPath := req.Req.URL.Path
+		if (req.Req.Method != http.MethodGet && req.Req.Method != http.MethodHead) || isExcluded(urlPath, config.Exclude) {
+			req.abortWithErr(http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+			return
+		}
+
+		name, ok := staticName(urlPath)
+		if !ok {
+			req.abortWithErr(http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+			return
+		}
+		if name != config.Index {
+			if info, err := fs.Stat(fsys, name); err == nil && !info.IsDir() {
+				req.serveStaticFile(fsys, name, assets)
+				return
+			}
+			if (name != "." && path.Ext(name) != "") || !acceptsHTML(req.Req.Header.Get("Accept")) {
+				req.abortWithErr(http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+				return
+			}
+		}
+
+		req.Writer.Header().Set("Cache-Control", "no-cache")
+		req.serveStaticFile(fsys, config.Index, shell)
+	}
+}
+
+// isExcluded reports whether the urlPath is under one of the prefixes.
+func isExcluded(urlPath string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(cleanPath(prefix), "/")
+		if urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsHTML reports whether the Accept header explicitly contains text/html,
+// which is sent by browsers for navigations but not for fetch or XHR requests.
+func acceptsHTML(accept string) bool {
+	for _, a := range parseAccept(accept) {
+		if a.mediaType == MIMEHTML && a.q > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package rapidroot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrStreamingUnsupported is returned when the response writer can't flush data to the client.
+	ErrStreamingUnsupported = errors.New("rapidroot: streaming is not supported by the response writer")
+	// ErrStreamClosed is returned when writing to a stream that was closed or whose client disconnected.
+	ErrStreamClosed = errors.New("rapidroot: stream is closed")
+)
+
+// SSEStream is a Server-Sent Events stream, see Request.SSE.
+// Every write is flushed to the client immediately. Writes are safe for
+// concurrent use, but the stream must not be used after the handler returns.
+type SSEStream struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	ctx     context.Context
+	marshal func(v any) ([]byte, error)
+
+	// guards writes and the pending id
+	mu sync.Mutex
+	id string
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	heartbeat sync.WaitGroup
+}
+
+// SSE starts a Server-Sent Events stream, it sends headers with 200 status code
+// to the client right away. If the response writer can't flush, it returns
+// ErrStreamingUnsupported without sending anything, so the handler can respond
+// in another way.
+// The stream is terminated when the client disconnects, Close is called or the
+// handler returns.
+//
+// Example:
+//
+//	stream, err := req.SSE()
+//	if err != nil {
+//		// handle err
+//	}
+//	defer stream.Close()
+//	stream.Heartbeat(15 * time.Second)
+//	for progress := range job.Progress() {
+//		if err := stream.Event("progress", progress); err != nil {
+//			return
+//		}
+//	}
+func (r *Request) SSE() (*SSEStream, error) {
+	if !canFlush(r.Writer) {
+		return nil, ErrStreamingUnsupported
+	}
+	rc := http.NewResponseController(r.Writer)
+
+	header := r.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	r.SetStatus(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil, ErrStreamingUnsupported
+	}
+	// the stream lives longer than the write timeout of the server
+	rc.SetWriteDeadline(time.Time{})
+
+	stream := &SSEStream{
+		w:       r.Writer,
+		rc:      rc,
+		ctx:     r.Req.Context(),
+		marshal: r.router.marshalJSON,
+		closed:  make(chan struct{}),
+	}
+	r.streams = append(r.streams, stream)
+	return stream, nil
+}
+
+// Event sends an event with the name and data to the client. If name is empty
+// the client receives it as a "message" event. Strings and byte slices are sent
+// as is, other values are encoded to JSON.
+func (s *SSEStream) Event(name string, data any) error {
+	payload, err := s.data(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+	if s.id != "" {
+		b.WriteString("id: " + s.id + "\n")
+		s.id = ""
+	}
+	if name != "" {
+		b.WriteString("event: " + sseSanitize(name) + "\n")
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(payload, "\r\n", "\n"), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.writeLocked(b.String())
+}
+
+// ID sets the id of the next event, the client will send it back in the
+// Last-Event-ID header when it reconnects.
+func (s *SSEStream) ID(id string) {
+	s.mu.Lock()
+	s.id = sseSanitize(id)
+	s.mu.Unlock()
+}
+
+// Retry tells the client how long to wait before reconnecting.
+func (s *SSEStream) Retry(d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeLocked(fmt.Sprintf("retry: %d\n\n", d.Milliseconds()))
+}
+
+// Comment sends a comment line, which is ignored by the client.
+func (s *SSEStream) Comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeLocked(": " + sseSanitize(text) + "\n\n")
+}
+
+// Heartbeat sends a comment every interval to keep the connection open through
+// proxies, until the stream is closed, the handler returns or the client
+// disconnects.
+func (s *SSEStream) Heartbeat(interval time.Duration) {
+	s.heartbeat.Add(1)
+	go func() {
+		defer s.heartbeat.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Comment("heartbeat"); err != nil {
+					return
+				}
+			case <-s.closed:
+				return
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Done returns a channel that is closed when the client disconnects.
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Close terminates the stream and waits for the heartbeat to stop.
+func (s *SSEStream) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		close(s.closed)
+		s.mu.Unlock()
+	})
+	s.heartbeat.Wait()
+	return nil
+}
+
+func (s *SSEStream) writeLocked(msg string) error {
+	select {
+	case <-s.closed:
+		return ErrStreamClosed
+	case <-s.ctx.Done():
+		return ErrStreamClosed
+	default:
+	}
+
+	if _, err := io.WriteString(s.w, msg); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *SSEStream) data(data any) (string, error) {
+	switch v := data.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	default:
+		encoded, err := s.marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to convert data to JSON: %w", err)
+		}
+		return string(encoded), nil
+	}
+}
+
+// canFlush reports whether the writer, or a writer wrapped by it, implements
+// http.Flusher, like http.ResponseController looks for it.
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		switch t := w.(type) {
+		case http.Flusher:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// sseSanitize removes line breaks, which would terminate a field.
+func sseSanitize(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
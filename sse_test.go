@@ -0,0 +1,34 @@
+package rapidroot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestSSEHeartbeatStopsWithHandler checks that the heartbeat of a stream,
+// which the handler didn't close, doesn't write to the released request.
+func TestSSEHeartbeatStopsWithHandler(t *testing.T) {
+	router := NewRouter()
+	router.GET("/events", func(req *Request) {
+		stream, err := req.SSE()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		stream.Heartbeat(time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+	})
+	if err := router.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	written := rec.Body.Len()
+	time.Sleep(20 * time.Millisecond)
+	if rec.Body.Len() != written {
+		t.Fatal("heartbeat kept writing after the handler returned")
+	}
+}
@@ -0,0 +1,246 @@
+package rapidroot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// staticPathParam is the name of the catch-all segment of static routes.
+const staticPathParam = "filepath"
+
+// StaticConfig configures static file serving, see Router.StaticWithConfig.
+type StaticConfig struct {
+	// Index is the file served for directories, e.g. "index.html".
+	// Empty value disables index files.
+	Index string
+
+	// Browse enables directory listing for directories without index file.
+	Browse bool
+
+	// Precompressed enables serving "name.br" and "name.gz" sibling files
+	// instead of "name" to clients that accept the encoding.
+	Precompressed bool
+
+	// MaxAge sets the Cache-Control max-age of the served files.
+	// Zero value doesn't set Cache-Control header.
+	MaxAge time.Duration
+}
+
+// DefaultStaticConfig returns the configuration used by Static and StaticFS.
+func DefaultStaticConfig() StaticConfig {
+	return StaticConfig{
+		Index:         "index.html",
+		Precompressed: true,
+	}
+}
+
+// Static serves files from the directory dir on disk under the prefix.
+//
+// Example:
+//
+//	router.Static("/assets", "./public")
+//	// GET /assets/css/main.css serves ./public/css/main.css
+func (r *Router) Static(prefix, dir string) {
+	r.StaticWithConfig(prefix, os.DirFS(dir), DefaultStaticConfig())
+}
+
+// StaticFS serves files from fsys under the prefix, it works with embed.FS.
+//
+// Example:
+//
+//	//go:embed public
+//	var public embed.FS
+//
+//	assets, _ := fs.Sub(public, "public")
+//	router.StaticFS("/assets", assets)
+func (r *Router) StaticFS(prefix string, fsys fs.FS) {
+	r.StaticWithConfig(prefix, fsys, DefaultStaticConfig())
+}
+
+// StaticWithConfig serves files from fsys under the prefix with the config.
+// Routes for GET and HEAD methods are registered. Requests for directories
+// without the trailing slash are redirected to the path with it.
+func (r *Router) StaticWithConfig(prefix string, fsys fs.FS, config StaticConfig) {
+	handler := func(req *Request) {
+		name, _ := req.Value(staticPathParam).(string)
+		req.serveStatic(fsys, name, config)
+	}
+
+	prefix = strings.TrimSuffix(cleanPath(prefix), "/")
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		r.handle(method, prefix, handler)
+		r.handle(method, prefix+"/*"+staticPathParam, handler)
+	}
+}
+
+// serveStatic serves the file with the name from fsys, the name is the path
+// requested by the client relative to the root of fsys.
+func (r *Request) serveStatic(fsys fs.FS, name string, config StaticConfig) {
+	name, ok := staticName(name)
+	if !ok {
+		r.abortWithErr(http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+		return
+	}
+
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		r.staticError(name, err)
+		return
+	}
+
+	if info.IsDir() {
+		if urlPath := r.Req.URL.Path; !strings.HasSuffix(urlPath, "/") {
+			// relative links of the index and the listing are resolved
+			// against the directory only with the trailing slash
+			target := path.Base(urlPath) + "/"
+			if r.Req.URL.RawQuery != "" {
+				target += "?" + r.Req.URL.RawQuery
+			}
+			r.Redirect(http.StatusMovedPermanently, target)
+			return
+		}
+		if config.Index != "" {
+			index := path.Join(name, config.Index)
+			if indexInfo, err := fs.Stat(fsys, index); err == nil && !indexInfo.IsDir() {
+				r.serveStaticFile(fsys, index, config)
+				return
+			}
+		}
+		if config.Browse {
+			r.serveDirList(fsys, name)
+			return
+		}
+		r.abortWithErr(http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+		return
+	}
+
+	r.serveStaticFile(fsys, name, config)
+}
+
+func (r *Request) serveStaticFile(fsys fs.FS, name string, config StaticConfig) {
+	header := r.Writer.Header()
+	if config.MaxAge > 0 {
+		header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(config.MaxAge.Seconds())))
+	}
+
+	servedName := name
+	if config.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		if compressed, encoding := precompressedSibling(fsys, name, r.Req.Header.Get("Accept-Encoding")); compressed != "" {
+			servedName = compressed
+			header.Set("Content-Encoding", encoding)
+		}
+	}
+
+	file, err := fsys.Open(servedName)
+	if err != nil {
+		r.staticError(servedName, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		r.staticError(servedName, err)
+		return
+	}
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			r.staticError(servedName, err)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	// the original name is used, so the Content-Type matches the uncompressed file
+	r.serveContent(http.StatusOK, path.Base(name), info.ModTime(), info.Size(), content)
+}
+
+// precompressedSibling returns the name and the encoding of a precompressed
+// version of the file, which is accepted by the client.
+func precompressedSibling(fsys fs.FS, name, acceptEncoding string) (string, string) {
+	if acceptEncoding == "" {
+		return "", ""
+	}
+	accepted := parseAccept(acceptEncoding)
+	for _, candidate := range []struct{ encoding, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if !acceptsEncoding(accepted, candidate.encoding) {
+			continue
+		}
+		if info, err := fs.Stat(fsys, name+candidate.ext); err == nil && !info.IsDir() {
+			return name + candidate.ext, candidate.encoding
+		}
+	}
+	return "", ""
+}
+
+func acceptsEncoding(accepted []acceptRange, encoding string) bool {
+	for _, a := range accepted {
+		if (a.mediaType == encoding || a.mediaType == "*") && a.q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Request) serveDirList(fsys fs.FS, name string) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		r.staticError(name, err)
+		return
+	}
+
+	base := strings.TrimSuffix(r.Req.URL.Path, "/") + "/"
+	var b strings.Builder
+	b.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := url.URL{Path: base + entry.Name()}
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", html.EscapeString(link.String()), html.EscapeString(entryName))
+	}
+	b.WriteString("</pre>\n")
+
+	r.write(http.StatusOK, "text/html; charset=utf-8", func(w io.Writer) error {
+		_, err := io.WriteString(w, b.String())
+		return err
+	})
+}
+
+func (r *Request) staticError(name string, err error) {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		r.abortWithErr(http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+		return
+	}
+	r.logError("failed to serve static file", "file", name, "error", err)
+	r.abortWithErr(http.StatusInternalServerError, fmt.Errorf(internalServerErr))
+}
+
+// staticName converts the requested path to a name valid for fs.FS, so it
+// can't escape the root of the file system.
+func staticName(name string) (string, bool) {
+	if strings.ContainsAny(name, "\x00\\") {
+		return "", false
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name)
+}
@@ -0,0 +1,239 @@
+package rapidroot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// MIMENDJSON is the media type of newline delimited JSON.
+	MIMENDJSON = "application/x-ndjson"
+
+	// streams are flushed every streamFlushRecords records, and records buffered
+	// for streamFlushInterval are flushed by a timer
+	streamFlushRecords  = 100
+	streamFlushInterval = time.Second
+)
+
+// JSONIterator returns the next item of a stream, ok is false when there are no more items.
+type JSONIterator func() (item any, ok bool, err error)
+
+// jsonStream writes records to the response and flushes them periodically.
+type jsonStream struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	ctx     context.Context
+	marshal func(v any) ([]byte, error)
+
+	// guards the writes, since the timer flushes concurrently
+	mu      sync.Mutex
+	records int
+	// timer flushes the buffered records, it's armed by the first record
+	// after a flush, which is tracked by pending
+	timer   *time.Timer
+	pending bool
+	closed  bool
+}
+
+func (r *Request) newJSONStream(code int, contentType string) *jsonStream {
+	r.Writer.Header().Set("Content-Type", contentType)
+	r.Writer.Header().Set("X-Content-Type-Options", "nosniff")
+	r.SetStatus(code)
+	rc := http.NewResponseController(r.Writer)
+	// the stream lives longer than the write timeout of the server
+	rc.SetWriteDeadline(time.Time{})
+	stream := &jsonStream{
+		w:       r.Writer,
+		rc:      rc,
+		ctx:     r.Req.Context(),
+		marshal: r.router.marshalJSON,
+	}
+	// the timer must not flush the released request
+	r.streams = append(r.streams, stream)
+	return stream
+}
+
+// record writes the encoded record, it returns ErrStreamClosed if the client disconnected.
+func (s *jsonStream) record(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writeLocked(data); err != nil {
+		return err
+	}
+	s.records++
+	if s.records%streamFlushRecords == 0 {
+		return s.flushLocked()
+	}
+	if !s.pending {
+		s.pending = true
+		if s.timer == nil {
+			s.timer = time.AfterFunc(streamFlushInterval, s.flushPending)
+		} else {
+			s.timer.Reset(streamFlushInterval)
+		}
+	}
+	return nil
+}
+
+func (s *jsonStream) writeLocked(data []byte) error {
+	if s.closed || s.ctx.Err() != nil {
+		return ErrStreamClosed
+	}
+	_, err := s.w.Write(data)
+	return err
+}
+
+func (s *jsonStream) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	return s.flushLocked()
+}
+
+// flushPending is called by the timer to flush the buffered records.
+func (s *jsonStream) flushPending() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending && !s.closed {
+		s.flushLocked()
+	}
+}
+
+func (s *jsonStream) flushLocked() error {
+	s.pending = false
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// end writes the tail of the response, flushes it and closes the stream.
+func (s *jsonStream) end(tail string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tail != "" {
+		if err := s.writeLocked([]byte(tail)); err != nil {
+			return err
+		}
+	}
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flushLocked()
+}
+
+// Close flushes the buffered records and stops the timer, it's called when
+// the handler returns.
+func (s *jsonStream) Close() error {
+	return s.end("")
+}
+
+// StreamJSONArray sends a JSON array with the items returned by next, without
+// keeping them in memory. The response is sent with a provided code right away,
+// so an error of next or a client disconnect truncates the response. In that
+// case the error is logged and returned.
+//
+// Example:
+//
+//	rows, err := db.Query("SELECT id, name FROM users")
+//	// handle err
+//	defer rows.Close()
+//	req.StreamJSONArray(200, func() (any, bool, error) {
+//		if !rows.Next() {
+//			return nil, false, rows.Err()
+//		}
+//		var u User
+//		err := rows.Scan(&u.ID, &u.Name)
+//		return u, true, err
+//	})
+func (r *Request) StreamJSONArray(code int, next JSONIterator) error {
+	stream := r.newJSONStream(code, MIMEJSON)
+	if err := stream.writeArray(next); err != nil {
+		r.logError("failed to stream JSON array", "error", err)
+		return err
+	}
+	return nil
+}
+
+func (s *jsonStream) writeArray(next JSONIterator) error {
+	// the timer isn't armed before the first record
+	if _, err := io.WriteString(s.w, "["); err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		item, ok, err := next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		encoded, err := s.marshal(item)
+		if err != nil {
+			return fmt.Errorf("failed to convert data to JSON: %w", err)
+		}
+		if i > 0 {
+			encoded = append([]byte(","), encoded...)
+		}
+		if err := s.record(encoded); err != nil {
+			return err
+		}
+	}
+	return s.end("]\n")
+}
+
+// NDJSONWriter writes newline delimited JSON records, see Request.NDJSON.
+// It must not be used after the handler returns.
+type NDJSONWriter struct {
+	stream *jsonStream
+}
+
+// NDJSON starts a newline delimited JSON response with a provided code.
+//
+// Example:
+//
+//	w := req.NDJSON(200)
+//	defer w.Close()
+//	for event := range events {
+//		if err := w.Encode(event); err != nil {
+//			return // client disconnected
+//		}
+//	}
+func (r *Request) NDJSON(code int) *NDJSONWriter {
+	return &NDJSONWriter{stream: r.newJSONStream(code, MIMENDJSON)}
+}
+
+// Encode writes v as a single line. It returns ErrStreamClosed after the client disconnects.
+func (w *NDJSONWriter) Encode(v any) error {
+	encoded, err := w.stream.marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to convert data to JSON: %w", err)
+	}
+	return w.stream.record(append(encoded, '\n'))
+}
+
+// Flush sends the buffered records to the client.
+func (w *NDJSONWriter) Flush() error {
+	return w.stream.flush()
+}
+
+// Done returns a channel that is closed when the client disconnects.
+func (w *NDJSONWriter) Done() <-chan struct{} {
+	return w.stream.ctx.Done()
+}
+
+// Close flushes the remaining records, further records return ErrStreamClosed.
+func (w *NDJSONWriter) Close() error {
+	return w.stream.Close()
+}
@@ -0,0 +1,60 @@
+package rapidroot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flushRecorder counts the flushes of the response.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	mu      sync.Mutex
+	flushes int
+}
+
+func (w *flushRecorder) Flush() {
+	w.mu.Lock()
+	w.flushes++
+	w.mu.Unlock()
+}
+
+func (w *flushRecorder) flushCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushes
+}
+
+// TestNDJSONPeriodicFlush checks that a buffered record is flushed after
+// streamFlushInterval, even if no other record is written.
+func TestNDJSONPeriodicFlush(t *testing.T) {
+	rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	router := NewRouter()
+	router.GET("/events", func(req *Request) {
+		w := req.NDJSON(http.StatusOK)
+		if err := w.Encode(map[string]int{"id": 1}); err != nil {
+			t.Error(err)
+			return
+		}
+		if rec.flushCount() != 0 {
+			t.Error("the record was flushed before the interval")
+		}
+		deadline := time.Now().Add(streamFlushInterval + 2*time.Second)
+		for rec.flushCount() == 0 {
+			if time.Now().After(deadline) {
+				t.Error("the buffered record wasn't flushed")
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	if err := router.Build(); err != nil {
+		t.Fatal(err)
+	}
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if rec.Body.String() != "{\"id\":1}\n" {
+		t.Fatalf("body = %q", rec.Body.String())
+	}
+}
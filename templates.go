@@ -0,0 +1,165 @@
+package rapidroot
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// TemplateConfig configures the template set of the router, see Router.LoadTemplatesFS.
+type TemplateConfig struct {
+	// Extension of the template files, defaults to ".html".
+	Extension string
+
+	// LayoutsDir is the directory with layout templates, relative to the root
+	// of the templates. Defaults to "layouts".
+	LayoutsDir string
+
+	// PartialsDir is the directory with partial templates, relative to the
+	// root of the templates. Defaults to "partials".
+	PartialsDir string
+
+	// Layout is the file in LayoutsDir that is executed to render every page,
+	// e.g. "base.html" with {{block "content" .}}{{end}} redefined by pages.
+	// If empty, the page itself is executed.
+	Layout string
+
+	// FuncMap is shared by all templates.
+	FuncMap template.FuncMap
+}
+
+// templateSet holds the parsed pages, each page is parsed together with all
+// layouts and partials.
+type templateSet struct {
+	pages  map[string]*template.Template
+	layout string
+}
+
+// LoadTemplates parses the templates from the directory dir on disk, see LoadTemplatesFS.
+func (r *Router) LoadTemplates(dir string, config TemplateConfig) error {
+	return r.LoadTemplatesFS(os.DirFS(dir), config)
+}
+
+// LoadTemplatesFS parses all templates from fsys once, after that Request.HTML
+// renders pages by their path relative to the root of fsys, instead of parsing
+// the file on every request.
+// Templates in the layouts and partials directories are available to every page.
+//
+// Example:
+//
+//	// templates/layouts/base.html: <html>{{block "content" .}}{{end}}</html>
+//	// templates/users/index.html:  {{define "content"}}{{template "partials/list.html" .}}{{end}}
+//	err := router.LoadTemplates("templates", rr.TemplateConfig{Layout: "base.html"})
+//
+//	func usersHandler(req *rr.Request) {
+//		req.HTML(200, "users/index.html", users)
+//	}
+func (r *Router) LoadTemplatesFS(fsys fs.FS, config TemplateConfig) error {
+	set, err := parseTemplates(fsys, config)
+	if err != nil {
+		return err
+	}
+	r.templateMu.Lock()
+	r.templateFS = fsys
+	r.templateConfig = config
+	r.templates.Store(set)
+	r.templateMu.Unlock()
+	if r.devMode {
+		r.startTemplateWatcher()
+	}
+	return nil
+}
+
+// templateFiles returns the file system and the config of the loaded templates.
+func (r *Router) templateFiles() (fs.FS, TemplateConfig) {
+	r.templateMu.RLock()
+	defer r.templateMu.RUnlock()
+	return r.templateFS, r.templateConfig
+}
+
+func parseTemplates(fsys fs.FS, config TemplateConfig) (*templateSet, error) {
+	if config.Extension == "" {
+		config.Extension = ".html"
+	}
+	if config.LayoutsDir == "" {
+		config.LayoutsDir = "layouts"
+	}
+	if config.PartialsDir == "" {
+		config.PartialsDir = "partials"
+	}
+
+	shared, pages := make([]string, 0), make([]string, 0)
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || path.Ext(name) != config.Extension {
+			return nil
+		}
+		if isInDir(name, config.LayoutsDir) || isInDir(name, config.PartialsDir) {
+			shared = append(shared, name)
+		} else {
+			pages = append(pages, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates: %w", err)
+	}
+
+	base := template.New("").Funcs(config.FuncMap)
+	for _, name := range shared {
+		if err := parseTemplateFile(fsys, base, name); err != nil {
+			return nil, err
+		}
+	}
+
+	set := &templateSet{pages: make(map[string]*template.Template, len(pages))}
+	if config.Layout != "" {
+		set.layout = path.Join(strings.Trim(config.LayoutsDir, "/"), config.Layout)
+		if base.Lookup(set.layout) == nil {
+			return nil, fmt.Errorf("layout %s doesn't exist", set.layout)
+		}
+	}
+	for _, name := range pages {
+		page, err := base.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("failed to clone templates for %s: %w", name, err)
+		}
+		if err := parseTemplateFile(fsys, page, name); err != nil {
+			return nil, err
+		}
+		set.pages[name] = page
+	}
+	return set, nil
+}
+
+func parseTemplateFile(fsys fs.FS, tmpl *template.Template, name string) error {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+	if _, err := tmpl.New(name).Parse(string(content)); err != nil {
+		return fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	return nil
+}
+
+// lookup returns the page template and the name of the template to execute.
+func (s *templateSet) lookup(name string) (*template.Template, string, bool) {
+	page, ok := s.pages[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return nil, "", false
+	}
+	if s.layout != "" {
+		return page, s.layout, true
+	}
+	return page, strings.TrimPrefix(name, "/"), true
+}
+
+func isInDir(name, dir string) bool {
+	return strings.HasPrefix(name, strings.Trim(dir, "/")+"/")
+}
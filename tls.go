@@ -0,0 +1,189 @@
+package rapidroot
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often CertReloader checks the certificate files for changes.
+const certCheckInterval = 10 * time.Second
+
+// DefaultTLSConfig returns the TLS configuration used by RunWithTLS: TLS 1.2 is
+// the minimum version and TLS 1.2 connections use only forward secret AEAD
+// cipher suites. TLS 1.3 cipher suites aren't configurable and are all secure.
+func DefaultTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+}
+
+// CertReloader serves a certificate from files and reloads it when the files
+// change on disk, e.g. when they are rotated by cert-manager. If the new files
+// can't be loaded, like in the middle of a rotation, the previous certificate
+// is served until the next check.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   Logger
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	snapshot string
+	checked  time.Time
+}
+
+// NewCertReloader loads the certificate and the key, and returns the reloader.
+//
+// Example:
+//
+//	reloader, err := rr.NewCertReloader("tls.crt", "tls.key")
+//	// handle err
+//	config := rr.DefaultTLSConfig()
+//	config.GetCertificate = reloader.GetCertificate
+//	err = router.RunWithTLSConfig(":443", config)
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   defaultLogger(),
+		checked:  time.Now(),
+	}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// GetCertificate returns the current certificate, it's used as tls.Config.GetCertificate.
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checked) >= certCheckInterval {
+		c.checked = time.Now()
+		if err := c.reloadLocked(); err != nil {
+			c.logger.Error("failed to reload the TLS certificate", "error", err)
+		}
+	}
+	return c.cert, nil
+}
+
+// Reload loads the certificate files if they changed since the last load.
+func (c *CertReloader) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reloadLocked()
+}
+
+func (c *CertReloader) reloadLocked() error {
+	snapshot, err := filesSnapshot(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	if snapshot == c.snapshot {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	if c.cert != nil {
+		c.logger.Info("TLS certificate reloaded", "file", c.certFile)
+	}
+	c.cert = &cert
+	c.snapshot = snapshot
+	return nil
+}
+
+// filesSnapshot returns a string, which changes when any of the files is modified.
+// Symbolic links are followed, so atomic swaps of Kubernetes secrets are noticed.
+func filesSnapshot(files ...string) (string, error) {
+	var snapshot string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		snapshot += fmt.Sprintf("%s|%d|%d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return snapshot, nil
+}
+
+// LoadCertPool returns a pool with the PEM encoded certificates of the files,
+// e.g. the certificate authorities of the clients for tls.Config.ClientCAs.
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", file)
+		}
+	}
+	return pool, nil
+}
+
+// PeerIdentity is the identity of a client authenticated with a certificate,
+// see Request.PeerIdentity.
+type PeerIdentity struct {
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	// URIs contain SPIFFE IDs, like spiffe://example.org/service.
+	URIs []*url.URL
+
+	// Certificate is the verified certificate of the client.
+	Certificate *x509.Certificate
+}
+
+// PeerIdentity returns the identity of the client, if it presented a
+// certificate verified by tls.Config.ClientCAs.
+//
+// Example:
+//
+//	config := rr.DefaultTLSConfig()
+//	config.ClientAuth = tls.RequireAndVerifyClientCert
+//	config.ClientCAs, err = rr.LoadCertPool("clients-ca.pem")
+//	// ...
+//	identity, ok := req.PeerIdentity()
+//	if !ok || identity.CommonName != "billing" {
+//		req.ERROR(http.StatusForbidden, errors.New("forbidden"))
+//		return
+//	}
+func (r *Request) PeerIdentity() (*PeerIdentity, bool) {
+	cert := r.PeerCertificate()
+	if cert == nil {
+		return nil, false
+	}
+	return &PeerIdentity{
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           cert.URIs,
+		Certificate:    cert,
+	}, true
+}
+
+// PeerCertificate returns the verified certificate of the client, or nil if
+// the client didn't present a verified certificate.
+func (r *Request) PeerCertificate() *x509.Certificate {
+	if r.Req.TLS == nil || len(r.Req.TLS.VerifiedChains) == 0 || len(r.Req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.Req.TLS.VerifiedChains[0][0]
+}
@@ -12,6 +12,8 @@ type node struct {
 	currentNodeMiddleware []Middleware
 	children              []*node
 	isDynamic             bool
+	// catch-all node matches the rest of the path, see isCatchAllSegment
+	isCatchAll bool
 }
 
 func newNode() *node {
@@ -27,9 +29,15 @@ func (n *node) freeMiddlewaresMemory() {
 	n.groupMiddleware = nil
 }
 
-func (n *node) child(pathSegment string) *node {
+// routeChild returns the child registered for the segment of a route, static
+// segments are told from dynamic and catch-all ones of the same name.
+func (n *node) routeChild(segment string) *node {
+	name, dynamic, catchAll := segment, isDynamicSegment(segment), isCatchAllSegment(segment)
+	if dynamic || catchAll {
+		name = segment[1:]
+	}
 	for _, child := range n.children {
-		if child.pathSegment == pathSegment {
+		if child.pathSegment == name && child.isDynamic == dynamic && child.isCatchAll == catchAll {
 			return child
 		}
 	}
@@ -45,7 +53,7 @@ func addRoute(path string, root *node, handler HandlerFunc) *node {
 	currentNode := root
 
 	for i, segment := range segments {
-		childNode := currentNode.child(segment)
+		childNode := currentNode.routeChild(segment)
 
 		if childNode == nil {
 			childNode = newNode()
@@ -60,6 +68,11 @@ func addRoute(path string, root *node, handler HandlerFunc) *node {
 			currentNode.pathSegment = segment[1:]
 		}
 
+		if isCatchAllSegment(segment) {
+			currentNode.isCatchAll = true
+			currentNode.pathSegment = segment[1:]
+		}
+
 		if isLastSegment(i, segments) {
 			currentNode.handler = handler
 		}
@@ -69,48 +82,51 @@ func addRoute(path string, root *node, handler HandlerFunc) *node {
 }
 
 func getNode(path string, root *node, req *Request) *node {
-	segments := strings.Split(path, "/")
-	currentNode := root
+	return matchNode(root, strings.Split(path, "/"), req)
+}
 
-	for i, segment := range segments {
-		childNode := currentNode.child(segment)
+// matchNode returns the node of the route matching segments below n. Static
+// children are tried first, if the rest of the path doesn't match below them
+// the lookup backtracks to the dynamic children and then to the catch-all
+// child. The values of the path are set only for the matching route.
+func matchNode(n *node, segments []string, req *Request) *node {
+	if len(segments) == 0 {
+		if n.handler == nil {
+			return nil
+		}
+		return n
+	}
+	segment, rest := segments[0], segments[1:]
 
-		if childNode == nil {
-			dynamicChild := findDynamicChild(currentNode.children, segments[i+1:])
-			if dynamicChild == nil {
-				// If no matching child is found and no dynamic segment is available,
-				// it means the route is not defined. Handle this case accordingly.
-				return nil
-			}
+	for _, child := range n.children {
+		if child.isDynamic || child.isCatchAll || child.pathSegment != segment {
+			continue
+		}
+		if found := matchNode(child, rest, req); found != nil {
+			return found
+		}
+	}
 
-			currentNode = dynamicChild
+	for _, child := range n.children {
+		if !child.isDynamic {
+			continue
+		}
+		if found := matchNode(child, rest, req); found != nil {
 			if req != nil {
-				req.SetValue(dynamicChild.pathSegment, segment)
+				req.SetValue(child.pathSegment, segment)
 			}
-		} else {
-			currentNode = childNode
-
-			if currentNode.isDynamic && req != nil {
-				req.SetValue(currentNode.pathSegment, segment)
-			}
-		}
-
-		if i == len(segments)-1 {
-			return currentNode
+			return found
 		}
 	}
 
-	return currentNode
-}
-
-func findDynamicChild(children []*node, remainingSegments []string) *node {
-	for _, dynamicChild := range children {
-		if dynamicChild.isDynamic {
-			nextNode := getNode(strings.Join(remainingSegments, "/"), dynamicChild, nil)
-			if nextNode != nil {
-				return dynamicChild
-			}
+	for _, child := range n.children {
+		if !child.isCatchAll || child.handler == nil {
+			continue
+		}
+		if req != nil {
+			req.SetValue(child.pathSegment, strings.Join(segments, "/"))
 		}
+		return child
 	}
 
 	return nil
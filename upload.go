@@ -0,0 +1,259 @@
+package rapidroot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultMultipartMemory is the memory used by multipart forms parsed
+// implicitly, the rest of the files is stored in temporary files.
+const defaultMultipartMemory = 32 << 20
+
+var (
+	// ErrFileTooLarge is returned when an uploaded file exceeds UploadLimits.MaxFileSize.
+	ErrFileTooLarge = errors.New("rapidroot: uploaded file is too large")
+	// ErrUploadTooLarge is returned when the request body exceeds UploadLimits.MaxTotalSize.
+	ErrUploadTooLarge = errors.New("rapidroot: upload is too large")
+	// ErrContentTypeNotAllowed is returned when the uploaded file type isn't in UploadLimits.AllowedTypes.
+	ErrContentTypeNotAllowed = errors.New("rapidroot: uploaded file content type is not allowed")
+)
+
+// UploadLimits restricts the uploads read by Request.MultipartReader.
+// Zero values mean no limit.
+type UploadLimits struct {
+	// MaxFileSize is the maximum size in bytes of a single file.
+	MaxFileSize int64
+
+	// MaxTotalSize is the maximum size in bytes of the whole request body.
+	MaxTotalSize int64
+
+	// AllowedTypes are the allowed content types of files, wildcards like
+	// "image/*" are supported.
+	AllowedTypes []string
+
+	// ReadTimeout is the time allowed for reading each part, it replaces the
+	// ReadTimeout of the server, which may be too short for big uploads.
+	// Zero keeps the deadline of the server, negative clears it.
+	ReadTimeout time.Duration
+}
+
+// FormFile returns the first file for the provided form key.
+// The multipart form is parsed with 32MB of memory if it isn't parsed yet.
+func (r *Request) FormFile(name string) (multipart.File, *multipart.FileHeader, error) {
+	return r.Req.FormFile(name)
+}
+
+// MultipartForm parses the multipart form, up to maxMemory bytes of files are
+// stored in memory and the rest in temporary files.
+func (r *Request) MultipartForm(maxMemory int64) (*multipart.Form, error) {
+	if err := r.Req.ParseMultipartForm(maxMemory); err != nil {
+		return nil, err
+	}
+	return r.Req.MultipartForm, nil
+}
+
+// SaveUploadedFile saves the uploaded file to dst, replacing it if it exists.
+func (r *Request) SaveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return saveToFile(src, dst)
+}
+
+func saveToFile(src io.Reader, dst string) error {
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// MultipartReader returns an iterator over the parts of a multipart request,
+// which reads the body as a stream and never buffers whole files, so it
+// suits uploads of any size. The ReadTimeout of the server still applies to
+// the whole body, unless UploadLimits.ReadTimeout gives each part its own time.
+//
+// Example:
+//
+//	parts, err := req.MultipartReader(rr.UploadLimits{
+//		MaxFileSize:  10 << 30,
+//		ReadTimeout:  10 * time.Minute,
+//		AllowedTypes: []string{"application/pdf", "image/*"},
+//	})
+//	// handle err
+//	for {
+//		part, err := parts.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		if err != nil {
+//			// handle err, e.g. ErrContentTypeNotAllowed
+//		}
+//		if part.IsFile() {
+//			err = part.Save(filepath.Join(dir, filepath.Base(part.FileName())))
+//			// handle err, e.g. ErrFileTooLarge
+//		}
+//	}
+func (r *Request) MultipartReader(limits UploadLimits) (*MultipartIterator, error) {
+	mediaType, params, err := mime.ParseMediaType(r.Req.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil, http.ErrNotMultipart
+	}
+
+	rc := http.NewResponseController(r.Writer)
+	if limits.ReadTimeout < 0 {
+		rc.SetReadDeadline(time.Time{})
+	}
+
+	body := io.Reader(r.Req.Body)
+	if limits.MaxTotalSize > 0 {
+		body = &limitedReader{r: body, remaining: limits.MaxTotalSize, err: ErrUploadTooLarge}
+	}
+	return &MultipartIterator{
+		reader: multipart.NewReader(body, params["boundary"]),
+		limits: limits,
+		rc:     rc,
+	}, nil
+}
+
+// MultipartIterator iterates over the parts of a multipart request, see Request.MultipartReader.
+type MultipartIterator struct {
+	reader  *multipart.Reader
+	limits  UploadLimits
+	rc      *http.ResponseController
+	current *UploadPart
+}
+
+// Next returns the next part, or io.EOF if there are no more parts.
+// The previous part is closed and can't be read anymore.
+// If the part is a file with not allowed content type, the part is returned
+// together with ErrContentTypeNotAllowed, so it can be skipped.
+func (it *MultipartIterator) Next() (*UploadPart, error) {
+	if it.current != nil {
+		it.current.Close()
+		it.current = nil
+	}
+
+	if it.limits.ReadTimeout > 0 {
+		it.rc.SetReadDeadline(time.Now().Add(it.limits.ReadTimeout))
+	}
+	part, err := it.reader.NextPart()
+	if err != nil {
+		return nil, err
+	}
+
+	uploadPart := &UploadPart{part: part, reader: part}
+	if uploadPart.IsFile() && it.limits.MaxFileSize > 0 {
+		uploadPart.reader = &limitedReader{r: part, remaining: it.limits.MaxFileSize, err: ErrFileTooLarge}
+	}
+	it.current = uploadPart
+
+	if uploadPart.IsFile() && len(it.limits.AllowedTypes) > 0 && !isAllowedType(uploadPart.ContentType(), it.limits.AllowedTypes) {
+		return uploadPart, fmt.Errorf("%w: %s", ErrContentTypeNotAllowed, uploadPart.ContentType())
+	}
+	return uploadPart, nil
+}
+
+// UploadPart is a single part of a multipart request, reading it streams the
+// content from the request body.
+type UploadPart struct {
+	part   *multipart.Part
+	reader io.Reader
+}
+
+// FormName returns the name of the form field.
+func (p *UploadPart) FormName() string {
+	return p.part.FormName()
+}
+
+// FileName returns the file name sent by the client, it must not be trusted
+// as a path on disk.
+func (p *UploadPart) FileName() string {
+	return p.part.FileName()
+}
+
+// IsFile reports whether the part is a file and not a plain form value.
+func (p *UploadPart) IsFile() bool {
+	return p.part.FileName() != ""
+}
+
+// ContentType returns the media type of the part sent by the client.
+func (p *UploadPart) ContentType() string {
+	mediaType, _, err := mime.ParseMediaType(p.part.Header.Get("Content-Type"))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// Read reads the content of the part, it returns ErrFileTooLarge or
+// ErrUploadTooLarge if the limits are exceeded.
+func (p *UploadPart) Read(b []byte) (int, error) {
+	return p.reader.Read(b)
+}
+
+// Save streams the content of the part to the file dst. If a limit is
+// exceeded, the partially written file is removed.
+func (p *UploadPart) Save(dst string) error {
+	if err := saveToFile(p, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// Close discards the rest of the part.
+func (p *UploadPart) Close() error {
+	return p.part.Close()
+}
+
+// limitedReader returns err after more than remaining bytes are read,
+// unlike io.LimitedReader which returns io.EOF.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+func (l *limitedReader) Read(b []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, l.err
+	}
+	// read one byte more than allowed to tell the end of input from an overflow
+	if int64(len(b)) > l.remaining+1 {
+		b = b[:l.remaining+1]
+	}
+	n, err := l.r.Read(b)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), l.err
+	}
+	return n, err
+}
+
+func isAllowedType(contentType string, allowed []string) bool {
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == contentType || pattern == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(contentType, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
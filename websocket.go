@@ -0,0 +1,562 @@
+package rapidroot
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types, as defined in RFC 6455 section 11.8.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// WebSocket close codes, as defined in RFC 6455 section 7.4.1.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	websocketGUID             = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	defaultWebSocketReadLimit = 1 << 20
+	maxControlFramePayload    = 125
+	closeWriteTimeout         = time.Second
+)
+
+// ErrWebSocketCloseSent is returned when writing to a connection after a close frame was sent.
+var ErrWebSocketCloseSent = errors.New("rapidroot: websocket close frame already sent")
+
+// CloseError is returned by WebSocketConn.ReadMessage when the connection is closed.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("rapidroot: websocket closed with code %d %s", e.Code, e.Text)
+}
+
+// WebSocketConfig configures WebSocket upgrades of the router.
+type WebSocketConfig struct {
+	// ReadLimit is the maximum size in bytes of a message read from the client,
+	// bigger messages close the connection with CloseMessageTooBig.
+	// Defaults to 1MB, if it's zero or negative.
+	ReadLimit int64
+
+	// Subprotocols supported by the server in order of preference, the first
+	// one requested by the client is selected.
+	Subprotocols []string
+
+	// CheckOrigin returns true if the request Origin header is acceptable.
+	// By default requests with an Origin whose host is not the request Host are rejected.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// WebSocketHandler handles an upgraded WebSocket connection, see Router.WS.
+type WebSocketHandler func(conn *WebSocketConn, req *Request)
+
+// SetWebSocketConfig sets the configuration used by Request.UpgradeWebSocket.
+func (r *Router) SetWebSocketConfig(config WebSocketConfig) {
+	r.wsConfig = config
+}
+
+// WS registers a WebSocket handler for GET requests on the path. The connection
+// is upgraded before the handler is called and closed after it returns.
+//
+// Example:
+//
+//	router.WS("/echo", func(conn *rr.WebSocketConn, req *rr.Request) {
+//		for {
+//			msgType, data, err := conn.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			if err := conn.WriteMessage(msgType, data); err != nil {
+//				return
+//			}
+//		}
+//	})
+func (r *Router) WS(path string, handler WebSocketHandler) {
+	if handler == nil {
+		r.handle(http.MethodGet, path, nil)
+		return
+	}
+	r.handle(http.MethodGet, path, func(req *Request) {
+		conn, err := req.UpgradeWebSocket()
+		if err != nil {
+			return
+		}
+		defer conn.Close(CloseNormalClosure, "")
+		handler(conn, req)
+	})
+}
+
+// UpgradeWebSocket performs the RFC 6455 opening handshake and takes over the
+// connection. If the handshake fails, the error response is written and an
+// error is returned.
+func (r *Request) UpgradeWebSocket() (*WebSocketConn, error) {
+	config := r.router.wsConfig
+	req := r.Req
+
+	if req.Method != http.MethodGet {
+		return nil, r.websocketError(http.StatusMethodNotAllowed, "request method is not GET")
+	}
+	if !headerContainsToken(req.Header, "Connection", "upgrade") {
+		return nil, r.websocketError(http.StatusBadRequest, "'upgrade' token not found in 'Connection' header")
+	}
+	if !headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return nil, r.websocketError(http.StatusBadRequest, "'websocket' token not found in 'Upgrade' header")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		r.Writer.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, r.websocketError(http.StatusUpgradeRequired, "unsupported version")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, r.websocketError(http.StatusBadRequest, "invalid 'Sec-WebSocket-Key' header")
+	}
+	checkOrigin := config.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		return nil, r.websocketError(http.StatusForbidden, "origin not allowed")
+	}
+
+	hijacker, ok := r.Writer.(http.Hijacker)
+	if !ok {
+		return nil, r.websocketError(http.StatusInternalServerError, "response writer doesn't support hijacking")
+	}
+	netConn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, r.websocketError(http.StatusInternalServerError, err.Error())
+	}
+	// clear the deadlines set by the server, the connection is now long-lived
+	netConn.SetDeadline(time.Time{})
+
+	subprotocol := selectSubprotocol(req.Header, config.Subprotocols)
+	var resp strings.Builder
+	resp.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	resp.WriteString("Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n")
+	if subprotocol != "" {
+		resp.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	resp.WriteString("\r\n")
+	if _, err := io.WriteString(netConn, resp.String()); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	readLimit := config.ReadLimit
+	if readLimit <= 0 {
+		readLimit = defaultWebSocketReadLimit
+	}
+	conn := &WebSocketConn{
+		conn:        netConn,
+		br:          brw.Reader,
+		subprotocol: subprotocol,
+		readLimit:   readLimit,
+	}
+	conn.pingHandler = func(data []byte) error {
+		return conn.WriteControl(PongMessage, data)
+	}
+	conn.pongHandler = func([]byte) error { return nil }
+	return conn, nil
+}
+
+func (r *Request) websocketError(code int, msg string) error {
+	err := fmt.Errorf("rapidroot: websocket handshake failed: %s", msg)
+	r.abortWithErr(code, errors.New(http.StatusText(code)))
+	return err
+}
+
+// WebSocketConn is a server side WebSocket connection. One goroutine may read
+// and another may write concurrently, writes are serialized internally.
+type WebSocketConn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	subprotocol string
+	readLimit   int64
+
+	pingHandler func(data []byte) error
+	pongHandler func(data []byte) error
+
+	// guards writes to the connection and closeSent
+	writeMu   sync.Mutex
+	closeSent bool
+
+	// readErr is the permanent error returned by ReadMessage after a failure
+	readErr error
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *WebSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr returns the remote network address.
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadLimit sets the maximum size in bytes of a message read from the client.
+// A zero or negative limit sets the default limit of 1MB, messages can't be unlimited.
+func (c *WebSocketConn) SetReadLimit(limit int64) {
+	if limit <= 0 {
+		limit = defaultWebSocketReadLimit
+	}
+	c.readLimit = limit
+}
+
+// SetReadDeadline sets the deadline for reading from the connection.
+func (c *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for writing to the connection.
+func (c *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetPingHandler sets the handler for ping messages, by default a pong with
+// the same payload is sent.
+func (c *WebSocketConn) SetPingHandler(handler func(data []byte) error) {
+	c.pingHandler = handler
+}
+
+// SetPongHandler sets the handler for pong messages.
+func (c *WebSocketConn) SetPongHandler(handler func(data []byte) error) {
+	c.pongHandler = handler
+}
+
+// ReadMessage reads the next text or binary message, joining fragmented
+// messages. Control frames are handled while reading. When the client closes
+// the connection, *CloseError is returned.
+func (c *WebSocketConn) ReadMessage() (messageType int, data []byte, err error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+
+	messageType, data, err = c.readMessage()
+	if err != nil {
+		c.readErr = err
+	}
+	return messageType, data, err
+}
+
+func (c *WebSocketConn) readMessage() (int, []byte, error) {
+	messageType := 0
+	message := make([]byte, 0)
+
+	for {
+		fin, opcode, payload, err := c.readFrame(int64(len(message)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err := c.pingHandler(payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if err := c.pongHandler(payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "expected continuation frame")
+			}
+			messageType = int(opcode)
+		}
+
+		message = append(message, payload...)
+		if fin {
+			if messageType == TextMessage && !utf8.Valid(message) {
+				return 0, nil, c.fail(CloseInvalidFramePayloadData, "invalid UTF-8 in text message")
+			}
+			return messageType, message, nil
+		}
+	}
+}
+
+// readFrame reads a single frame, read is the size of the message read so far
+// and is used to enforce the read limit.
+func (c *WebSocketConn) readFrame(read int64) (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, c.abnormal(err)
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits are set")
+	}
+	switch opcode {
+	case continuationFrame, TextMessage, BinaryMessage, CloseMessage, PingMessage, PongMessage:
+	default:
+		return false, 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode))
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "client frame is not masked")
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, c.abnormal(err)
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, c.abnormal(err)
+		}
+		if ext[0]&0x80 != 0 {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid payload length")
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if opcode >= CloseMessage {
+		if !fin || length > maxControlFramePayload {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+		}
+	} else if read+length > c.readLimit {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, c.abnormal(err)
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, c.abnormal(err)
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+func (c *WebSocketConn) handleClose(payload []byte) error {
+	code, text := CloseNoStatusReceived, ""
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close frame")
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		text = string(payload[2:])
+		if !validCloseCode(code) {
+			return c.fail(CloseProtocolError, "invalid close code")
+		}
+		if !utf8.ValidString(text) {
+			return c.fail(CloseInvalidFramePayloadData, "invalid UTF-8 in close reason")
+		}
+	}
+
+	replyCode := code
+	if replyCode == CloseNoStatusReceived {
+		replyCode = CloseNormalClosure
+	}
+	c.Close(replyCode, "")
+	return &CloseError{Code: code, Text: text}
+}
+
+// fail closes the connection with the code because of the client's protocol violation.
+func (c *WebSocketConn) fail(code int, reason string) error {
+	c.Close(code, reason)
+	return &CloseError{Code: code, Text: reason}
+}
+
+// abnormal closes the connection after a network error.
+func (c *WebSocketConn) abnormal(err error) error {
+	c.conn.Close()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &CloseError{Code: CloseAbnormalClosure, Text: err.Error()}
+	}
+	return err
+}
+
+// WriteMessage sends a text or binary message in a single frame.
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("rapidroot: invalid websocket message type %d", messageType)
+	}
+	return c.writeFrame(byte(messageType), data)
+}
+
+// WriteText sends a text message.
+func (c *WebSocketConn) WriteText(text string) error {
+	return c.WriteMessage(TextMessage, []byte(text))
+}
+
+// WriteControl sends a ping or pong control message.
+func (c *WebSocketConn) WriteControl(messageType int, data []byte) error {
+	if messageType != PingMessage && messageType != PongMessage {
+		return fmt.Errorf("rapidroot: invalid websocket control message type %d", messageType)
+	}
+	if len(data) > maxControlFramePayload {
+		return errors.New("rapidroot: websocket control frame payload is too big")
+	}
+	return c.writeFrame(byte(messageType), data)
+}
+
+// Ping sends a ping message to the client.
+func (c *WebSocketConn) Ping(data []byte) error {
+	return c.WriteControl(PingMessage, data)
+}
+
+// Close sends a close frame with the code and reason and closes the underlying
+// connection. Calling Close more than once is safe.
+func (c *WebSocketConn) Close(code int, reason string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+
+	if len(reason) > maxControlFramePayload-2 {
+		reason = reason[:maxControlFramePayload-2]
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+
+	c.conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+	err := c.writeFrameLocked(CloseMessage, payload)
+	if closeErr := c.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (c *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return ErrWebSocketCloseSent
+	}
+	return c.writeFrameLocked(opcode, payload)
+}
+
+func (c *WebSocketConn) writeFrameLocked(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, 10+len(payload))
+	frame = append(frame, 0x80|opcode)
+
+	length := len(payload)
+	switch {
+	case length <= 125:
+		frame = append(frame, byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	frame = append(frame, payload...)
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+func websocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// headerContainsToken reports whether the comma separated header contains the token.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectSubprotocol returns the first of the supported subprotocols, which is
+// requested by the client.
+func selectSubprotocol(header http.Header, supported []string) string {
+	var requested []string
+	for _, value := range header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			requested = append(requested, strings.TrimSpace(protocol))
+		}
+	}
+	for _, protocol := range supported {
+		if contains(requested, protocol) {
+			return protocol
+		}
+	}
+	return ""
+}
+
+// sameOrigin is the default origin check, which accepts requests without
+// Origin header or with the same host as the request.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,285 @@
+package rapidroot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsClient is a minimal RFC 6455 client used to test the server side.
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+	resp *http.Response
+}
+
+func dialWebSocket(t *testing.T, server *httptest.Server, path string, header http.Header) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wsClient{t: t, conn: conn, br: br, resp: resp}
+}
+
+func (c *wsClient) writeFrame(fin bool, opcode byte, payload []byte) {
+	c.t.Helper()
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) readFrame() (opcode byte, payload []byte) {
+	c.t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if header[1]&0x80 != 0 {
+		c.t.Fatal("server frame is masked")
+	}
+	length := int(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+func (c *wsClient) expectClose(code int) {
+	c.t.Helper()
+	opcode, payload := c.readFrame()
+	if opcode != CloseMessage || len(payload) < 2 {
+		c.t.Fatalf("expected close frame, got opcode %d", opcode)
+	}
+	if got := int(binary.BigEndian.Uint16(payload)); got != code {
+		c.t.Fatalf("close code = %d, want %d", got, code)
+	}
+}
+
+func newWebSocketServer(t *testing.T, config WebSocketConfig, handler WebSocketHandler) *httptest.Server {
+	t.Helper()
+	router := NewRouter()
+	router.SetWebSocketConfig(config)
+	router.WS("/ws", handler)
+	if err := router.Build(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func echoHandler(conn *WebSocketConn, req *Request) {
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.WriteMessage(messageType, data); err != nil {
+			return
+		}
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	server := newWebSocketServer(t, WebSocketConfig{}, echoHandler)
+	client := dialWebSocket(t, server, "/ws", nil)
+
+	if client.resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", client.resp.StatusCode)
+	}
+	// the example key of RFC 6455 section 1.3
+	if got := client.resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", got)
+	}
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	server := newWebSocketServer(t, WebSocketConfig{}, echoHandler)
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"version", http.Header{"Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+		{"key", http.Header{"Sec-Websocket-Key": {"short"}}, http.StatusBadRequest},
+		{"origin", http.Header{"Origin": {"https://evil.example"}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dialWebSocket(t, server, "/ws", tt.header)
+			if client.resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", client.resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestWebSocketSubprotocolPreference(t *testing.T) {
+	config := WebSocketConfig{Subprotocols: []string{"v2.chat", "v1.chat"}}
+	server := newWebSocketServer(t, config, echoHandler)
+
+	client := dialWebSocket(t, server, "/ws", http.Header{"Sec-Websocket-Protocol": {"v1.chat, v2.chat"}})
+	if got := client.resp.Header.Get("Sec-WebSocket-Protocol"); got != "v2.chat" {
+		t.Fatalf("subprotocol = %q, want the server preference v2.chat", got)
+	}
+
+	client = dialWebSocket(t, server, "/ws", http.Header{"Sec-Websocket-Protocol": {"v3.chat"}})
+	if got := client.resp.Header.Get("Sec-WebSocket-Protocol"); got != "" {
+		t.Fatalf("subprotocol = %q, want none", got)
+	}
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	server := newWebSocketServer(t, WebSocketConfig{}, echoHandler)
+	client := dialWebSocket(t, server, "/ws", nil)
+
+	client.writeFrame(true, TextMessage, []byte("hello"))
+	if opcode, payload := client.readFrame(); opcode != TextMessage || string(payload) != "hello" {
+		t.Fatalf("got %d %q", opcode, payload)
+	}
+
+	big := []byte(strings.Repeat("x", 70000))
+	client.writeFrame(true, BinaryMessage, big)
+	if opcode, payload := client.readFrame(); opcode != BinaryMessage || len(payload) != len(big) {
+		t.Fatalf("got %d with %d bytes", opcode, len(payload))
+	}
+}
+
+func TestWebSocketFragmentationAndPing(t *testing.T) {
+	server := newWebSocketServer(t, WebSocketConfig{}, echoHandler)
+	client := dialWebSocket(t, server, "/ws", nil)
+
+	client.writeFrame(false, TextMessage, []byte("hel"))
+	// control frames may be interleaved with fragments
+	client.writeFrame(true, PingMessage, []byte("p"))
+	client.writeFrame(true, continuationFrame, []byte("lo"))
+
+	if opcode, payload := client.readFrame(); opcode != PongMessage || string(payload) != "p" {
+		t.Fatalf("got %d %q, want pong", opcode, payload)
+	}
+	if opcode, payload := client.readFrame(); opcode != TextMessage || string(payload) != "hello" {
+		t.Fatalf("got %d %q", opcode, payload)
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	closed := make(chan error, 1)
+	server := newWebSocketServer(t, WebSocketConfig{}, func(conn *WebSocketConn, req *Request) {
+		_, _, err := conn.ReadMessage()
+		closed <- err
+	})
+	client := dialWebSocket(t, server, "/ws", nil)
+
+	payload := binary.BigEndian.AppendUint16(nil, CloseGoingAway)
+	client.writeFrame(true, CloseMessage, append(payload, "bye"...))
+	client.expectClose(CloseGoingAway)
+
+	var closeErr *CloseError
+	if err := <-closed; !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway || closeErr.Text != "bye" {
+		t.Fatalf("ReadMessage error = %v", err)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(c *wsClient)
+		code  int
+	}{
+		{"unmasked", func(c *wsClient) { c.conn.Write([]byte{0x81, 0x01, 'a'}) }, CloseProtocolError},
+		{"continuation", func(c *wsClient) { c.writeFrame(true, continuationFrame, []byte("a")) }, CloseProtocolError},
+		{"invalid utf8", func(c *wsClient) { c.writeFrame(true, TextMessage, []byte{0xff}) }, CloseInvalidFramePayloadData},
+		{"fragmented control", func(c *wsClient) { c.writeFrame(false, PingMessage, nil) }, CloseProtocolError},
+	}
+	server := newWebSocketServer(t, WebSocketConfig{}, echoHandler)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dialWebSocket(t, server, "/ws", nil)
+			tt.write(client)
+			client.expectClose(tt.code)
+		})
+	}
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	server := newWebSocketServer(t, WebSocketConfig{ReadLimit: 10}, echoHandler)
+	client := dialWebSocket(t, server, "/ws", nil)
+
+	client.writeFrame(false, TextMessage, []byte("123456"))
+	client.writeFrame(true, continuationFrame, []byte("789012"))
+	client.expectClose(CloseMessageTooBig)
+}
+
+func TestWebSocketSetReadLimitKeepsLimit(t *testing.T) {
+	server := newWebSocketServer(t, WebSocketConfig{}, func(conn *WebSocketConn, req *Request) {
+		conn.SetReadLimit(0)
+		echoHandler(conn, req)
+	})
+	client := dialWebSocket(t, server, "/ws", nil)
+
+	// only the header of a frame announcing a huge payload is sent
+	header := []byte{0x82, 0x80 | 127}
+	header = binary.BigEndian.AppendUint64(header, 1<<62)
+	client.conn.Write(header)
+	client.expectClose(CloseMessageTooBig)
+}